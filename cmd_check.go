@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/internal"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "check",
+		Short:   "Check the input file is sorted",
+		PreRunE: loadSettings,
+		RunE:    checkRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.InputFlag(cmd)
+	internal.KeyFlags(cmd)
+	return cmd
+}
+
+func checkRun(_ *cobra.Command, _ []string) error {
+	allocate, err := newAllocate()
+	if err != nil {
+		return err
+	}
+	f, err := openInput(internal.InputFile)
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	defer f.Close()
+	err = file.CheckSorted(f, allocate)
+	if err != nil {
+		return errors.Wrap(err, "checking input")
+	}
+	fmt.Fprintln(os.Stderr, "sorted")
+	return nil
+}
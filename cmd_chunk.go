@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/internal"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newChunkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "chunk",
+		Short:   "Split the input file into sorted chunks",
+		Long:    "Split the input file into sorted chunks, in a unique folder created in the chunk folder, and print their paths. The chunks can then be merged with the merge command.",
+		PreRunE: loadSettings,
+		RunE:    chunkRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.InputFlag(cmd)
+	internal.ChunkFlags(cmd)
+	internal.ErrorPolicyFlags(cmd)
+	internal.KeyFlags(cmd)
+	return cmd
+}
+
+func chunkRun(cmd *cobra.Command, _ []string) error {
+	allocate, err := newAllocate()
+	if err != nil {
+		return err
+	}
+	f, err := openInput(internal.InputFile)
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	defer f.Close()
+	store, err := newChunkStore()
+	if err != nil {
+		return err
+	}
+	fI := &file.Info{
+		Input:          f,
+		Allocate:       allocate,
+		ChunkStore:     store,
+		CompressChunks: internal.CompressChunks,
+		MaxTempBytes:   internal.MaxTempBytes,
+		ErrorPolicy:    internal.ErrorPolicy,
+	}
+	if internal.ErrorPolicy == file.ErrorPolicyQuarantine {
+		quarantine, err := os.Create(internal.QuarantineFile)
+		if err != nil {
+			return errors.Wrap(err, "creating quarantine file")
+		}
+		defer quarantine.Close()
+		fI.Quarantine = quarantine
+	}
+	err = fI.CreateSortedChunks(cmd.Context(), internal.ChunkSize, internal.MaxWorkers)
+	if err != nil {
+		return errors.Wrap(err, "creating chunks")
+	}
+	if internal.ErrorPolicy != file.ErrorPolicyFail {
+		fmt.Fprintln(os.Stderr, "skipped rows", fI.SkippedRows())
+	}
+	chunkNames, err := fI.ChunkNames()
+	if err != nil {
+		return errors.Wrap(err, "dumping chunks")
+	}
+	// the chunks are kept for the merge command.
+	err = store.(file.Cleaner).Cleanup(true) // nolint:forcetypeassert // newChunkStore returns run stores.
+	if err != nil {
+		return err
+	}
+	for _, chunkName := range chunkNames {
+		if s, ok := store.(interface{ Path(string) string }); ok {
+			chunkName = s.Path(chunkName)
+		}
+		fmt.Println(chunkName)
+	}
+	return nil
+}
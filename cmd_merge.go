@@ -0,0 +1,82 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/internal"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "merge [flags] input...",
+		Long:    "Merge already sorted input files. An input \"-\" is read from stdin, and an input ending with .gz is decompressed.",
+		Short:   "Merge already sorted input files",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: loadSettings,
+		RunE:    mergeRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.OutputFlag(cmd)
+	internal.OutputBufferFlag(cmd)
+	internal.KeyFlags(cmd)
+	return cmd
+}
+
+func mergeRun(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	allocate, err := newAllocate()
+	if err != nil {
+		return err
+	}
+	inputs := make([]io.Reader, 0, len(args))
+	stdin := 0
+	for _, inputPath := range args {
+		if inputPath == "-" {
+			stdin++
+		}
+		if stdin > 1 {
+			return errors.New("stdin can only be merged once")
+		}
+		f, err := openInput(inputPath)
+		if err != nil {
+			return errors.Wrap(err, "opening input path")
+		}
+		defer f.Close()
+		var input io.Reader = f
+		// the chunks created with --compress_chunks are gzipped.
+		if strings.HasSuffix(inputPath, ".gz") {
+			input, err = gzip.NewReader(f)
+			if err != nil {
+				return errors.Wrapf(err, "reading %s", inputPath)
+			}
+		}
+		inputs = append(inputs, input)
+	}
+	output, err := createOutput(internal.OutputFile)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	defer func() {
+		err := output.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}()
+
+	err = file.Merge(cmd.Context(), inputs, output, allocate, internal.OutputBufferSize)
+	if err != nil {
+		return errors.Wrap(err, "merging inputs")
+	}
+
+	elapsed := time.Since(start)
+	fmt.Fprintln(os.Stderr, elapsed)
+	return nil
+}
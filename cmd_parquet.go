@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/file/parquetfile"
+	"github.com/askiada/external-sort/internal"
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newParquetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "parquet",
+		Short:   "Sort the rows of a Parquet file by columns",
+		Long:    "Sort the rows of a Parquet file by the columns and write a Parquet file with the same schema. The input must be a file.",
+		PreRunE: loadSettings,
+		RunE:    parquetRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.InputFlag(cmd)
+	internal.OutputFlag(cmd)
+	internal.ChunkFlags(cmd)
+	internal.OutputBufferFlag(cmd)
+	internal.ColumnFlag(cmd)
+	return cmd
+}
+
+func parquetRun(cmd *cobra.Command, _ []string) error {
+	start := time.Now()
+	if internal.InputFile == "" || internal.InputFile == "-" {
+		return errors.New("the Parquet input must be a file")
+	}
+	f, err := os.Open(internal.InputFile)
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	output, err := createOutput(internal.OutputFile)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	defer func() {
+		err := output.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}()
+	store, err := newChunkStore()
+	if err != nil {
+		return err
+	}
+	err = parquetfile.Sort(cmd.Context(), f, stat.Size(), output, internal.Columns, file.Sorter[parquet.Row]{
+		ChunkStore:     store,
+		ChunkSize:      internal.ChunkSize,
+		Workers:        int(internal.MaxWorkers),
+		BufferSize:     internal.OutputBufferSize,
+		MaxTempBytes:   internal.MaxTempBytes,
+		CompressChunks: internal.CompressChunks,
+		Progress:       true,
+	})
+	if err != nil {
+		return errors.Wrap(err, "sorting parquet file")
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintln(os.Stderr, elapsed)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/internal"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newSortCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "sort",
+		Short:   "Sort the input file",
+		PreRunE: loadSettings,
+		RunE:    sortRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.InputFlag(cmd)
+	internal.OutputFlag(cmd)
+	internal.ChunkFlags(cmd)
+	internal.ErrorPolicyFlags(cmd)
+	internal.KeepChunksFlag(cmd)
+	internal.OutputBufferFlag(cmd)
+	internal.KeyFlags(cmd)
+	internal.ShuffleFlags(cmd)
+	return cmd
+}
+
+func sortRun(cmd *cobra.Command, _ []string) error {
+	start := time.Now()
+	allocate, err := newAllocate()
+	if err != nil {
+		return err
+	}
+	f, err := openInput(internal.InputFile)
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	defer f.Close()
+	output, err := createOutput(internal.OutputFile)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	defer func() {
+		err := output.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}()
+	store, err := newChunkStore()
+	if err != nil {
+		return err
+	}
+	fI := &file.Info{
+		Input:          f,
+		Allocate:       allocate,
+		Output:         output,
+		ChunkStore:     store,
+		CompressChunks: internal.CompressChunks,
+		MaxTempBytes:   internal.MaxTempBytes,
+		KeepChunks:     internal.KeepChunks,
+		ErrorPolicy:    internal.ErrorPolicy,
+	}
+	if internal.Shuffle {
+		fI.Shuffle, err = newShuffle()
+		if err != nil {
+			return err
+		}
+	}
+	if internal.ErrorPolicy == file.ErrorPolicyQuarantine {
+		quarantine, err := os.Create(internal.QuarantineFile)
+		if err != nil {
+			return errors.Wrap(err, "creating quarantine file")
+		}
+		defer quarantine.Close()
+		fI.Quarantine = quarantine
+	}
+
+	err = fI.Sort(cmd.Context(), internal.ChunkSize, int(internal.MaxWorkers), internal.OutputBufferSize)
+	if err != nil {
+		return errors.Wrap(err, "sorting file")
+	}
+
+	if internal.ErrorPolicy != file.ErrorPolicyFail {
+		fmt.Fprintln(os.Stderr, "skipped rows", fI.SkippedRows())
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintln(os.Stderr, elapsed)
+	return nil
+}
+
+// newShuffle returns the shuffle of the settings. The seed is logged so that
+// the order can be reproduced.
+func newShuffle() (*file.Shuffle, error) {
+	log.WithField("seed", internal.Seed).Info("shuffle")
+	shuffle := &file.Shuffle{Seed: internal.Seed}
+	if internal.Group {
+		group, err := internal.NewGroupKey(internal.Format, internal.Keys)
+		if err != nil {
+			return nil, err
+		}
+		shuffle.Group = group
+	}
+	return shuffle, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/askiada/external-sort/internal"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stats",
+		Short:   "Print statistics about the input file",
+		Long:    "Print the number of rows and bytes of the input file, and the number of chunks a sort with the given chunk size would create.",
+		PreRunE: loadSettings,
+		RunE:    statsRun,
+	}
+	internal.ConfigFlag(cmd)
+	internal.InputFlag(cmd)
+	internal.ChunkSizeFlag(cmd)
+	return cmd
+}
+
+func statsRun(_ *cobra.Command, _ []string) error {
+	f, err := openInput(internal.InputFile)
+	if err != nil {
+		return errors.Wrap(err, "opening input path")
+	}
+	defer f.Close()
+	rows, size := 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rows++
+		size += len(scanner.Bytes()) + 1
+	}
+	if scanner.Err() != nil {
+		return errors.Wrap(scanner.Err(), "error while scanning")
+	}
+	fmt.Println("rows", rows)
+	fmt.Println("bytes", size)
+	fmt.Println("chunks", (rows+internal.ChunkSize-1)/internal.ChunkSize)
+	return nil
+}
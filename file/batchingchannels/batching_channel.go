@@ -3,8 +3,11 @@ package batchingchannels
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 
 	"github.com/askiada/external-sort/vector"
+	"github.com/askiada/external-sort/vector/key"
+	"github.com/askiada/external-sort/vector/typed"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
@@ -12,56 +15,142 @@ import (
 // BatchingChannel implements the Channel interface, with the change that instead of producing individual elements
 // on Out(), it batches together the entire internal buffer each time. Trying to construct an unbuffered batching channel
 // will panic, that configuration is not supported (and provides no benefit over an unbuffered NativeChannel).
-type BatchingChannel struct {
-	input    chan string
-	output   chan vector.Vector
-	buffer   vector.Vector
-	allocate *vector.Allocate
-	g        *errgroup.Group
-	sem      *semaphore.Weighted
-	dCtx     context.Context
-	size     int
-}
-
-// NewBatchingChannel returns a BatchingChannel with max workers. It creates a
-// goroutine and will stop it when the context is cancelled. It returns an
-// error if the input is invalid.
-func NewBatchingChannel(ctx context.Context, allocate *vector.Allocate, maxWorker int64, size int) (*BatchingChannel, error) {
+// The values of type T are collected into batches of type B built by a Batcher.
+type BatchingChannel[T, B any] struct {
+	input   chan T
+	output  chan B
+	batcher Batcher[T, B]
+	g       *errgroup.Group
+	sem     *semaphore.Weighted
+	ctx     context.Context
+	dCtx    context.Context
+	options[T]
+	size int
+	// fill is the number of values in the batch being collected.
+	fill int64
+}
+
+// VectorChannel batches lines into vectors.
+type VectorChannel = BatchingChannel[string, vector.Vector]
+
+// Batcher builds the batches of a BatchingChannel.
+type Batcher[T, B any] struct {
+	// New returns an empty batch for size values.
+	New func(size int) B
+	// Push adds the value at the end of the batch and returns the batch.
+	Push func(batch B, value T) (B, error)
+}
+
+// VectorBatcher returns the Batcher of the vectors allocated by allocate.
+func VectorBatcher(allocate *vector.Allocate) Batcher[string, vector.Vector] {
+	return AllocatorBatcher[key.Key](allocate)
+}
+
+// AllocatorBatcher returns the Batcher of the typed vectors created by
+// allocate.
+func AllocatorBatcher[K any](allocate typed.Allocator[K]) Batcher[string, typed.Vector[K]] {
+	return Batcher[string, typed.Vector[K]]{
+		New: allocate.NewVector,
+		Push: func(v typed.Vector[K], line string) (typed.Vector[K], error) {
+			return v, v.PushBack(line)
+		},
+	}
+}
+
+// RejectFunc is called when the value received on the given row, starting at
+// 1, can't be added to a batch. The value is dropped if it returns nil,
+// otherwise the returned error stops the processing.
+type RejectFunc[T any] func(row int, value T, err error) error
+
+// Option configures a BatchingChannel.
+type Option[T any] func(*options[T])
+
+type options[T any] struct {
+	reject RejectFunc[T]
+}
+
+// WithReject sets the function called when a value can't be added to a batch.
+// By default the error stops the processing.
+func WithReject[T any](reject RejectFunc[T]) Option[T] {
+	return func(o *options[T]) {
+		o.reject = reject
+	}
+}
+
+// NewBatchingChannel returns a BatchingChannel of vectors with max workers. It
+// creates a goroutine and will stop it when the context is cancelled or a
+// worker fails. It returns an error if the input is invalid.
+func NewBatchingChannel(ctx context.Context, allocate *vector.Allocate, maxWorker int64, size int,
+	opts ...Option[string]) (*VectorChannel, error) {
+	return New(ctx, VectorBatcher(allocate), maxWorker, size, opts...)
+}
+
+// New returns a BatchingChannel with max workers collecting the values into
+// batches of size values built by batcher. It creates a goroutine and will stop
+// it when the context is cancelled or a worker fails. It returns an error if
+// the input is invalid.
+func New[T, B any](ctx context.Context, batcher Batcher[T, B], maxWorker int64, size int, opts ...Option[T]) (*BatchingChannel[T, B], error) {
 	if size == 0 {
 		return nil, errors.New("channels: BatchingChannel does not support unbuffered behaviour")
 	}
 	if size < 0 {
 		return nil, errors.New("channels: invalid negative size in NewBatchingChannel")
 	}
+	if maxWorker <= 0 {
+		return nil, errors.New("channels: invalid max worker in NewBatchingChannel")
+	}
 	g, dCtx := errgroup.WithContext(ctx)
-	ch := &BatchingChannel{
-		input:    make(chan string),
-		output:   make(chan vector.Vector),
-		size:     size,
-		allocate: allocate,
-		g:        g,
-		sem:      semaphore.NewWeighted(maxWorker),
-		dCtx:     dCtx,
+	ch := &BatchingChannel[T, B]{
+		input:   make(chan T),
+		output:  make(chan B),
+		size:    size,
+		batcher: batcher,
+		g:       g,
+		sem:     semaphore.NewWeighted(maxWorker),
+		ctx:     ctx,
+		dCtx:    dCtx,
+	}
+	for _, opt := range opts {
+		opt(&ch.options)
 	}
-	go ch.batchingBuffer(ctx)
+	go ch.batchingBuffer()
 	return ch, nil
 }
 
-func (ch *BatchingChannel) In() chan<- string {
+// In returns the input channel. A producer blocked on it is not released when
+// the processing stops, Send should be preferred.
+func (ch *BatchingChannel[T, B]) In() chan<- T {
 	return ch.input
 }
 
-// Out returns a <-chan vector.Vector in order that BatchingChannel conforms to the standard Channel interface provided
-// by this package, however each output value is guaranteed to be of type vector.Vector - a vector collecting the most
-// recent batch of values sent on the In channel. The vector is guaranteed to not be empty or nil.
-func (ch *BatchingChannel) Out() <-chan vector.Vector {
+// Send sends the value to the channel. It returns an error, without sending
+// the value, once the processing is stopped by the context or by an error. The
+// cause of the stop is returned by ProcessOut.
+func (ch *BatchingChannel[T, B]) Send(value T) error {
+	select {
+	case ch.input <- value:
+		return nil
+	case <-ch.dCtx.Done():
+		return ch.dCtx.Err()
+	}
+}
+
+// Out returns a <-chan B in order that BatchingChannel conforms to the standard Channel interface provided
+// by this package, however each output value is guaranteed to be a batch collecting the most
+// recent values sent on the In channel. The batch is guaranteed to not be empty.
+func (ch *BatchingChannel[T, B]) Out() <-chan B {
 	return ch.output
 }
 
-func (ch *BatchingChannel) ProcessOut(f func(vector.Vector) error) error {
+// ProcessOut calls f on each batch, with at most max workers at the same time.
+// It returns once all the batches are processed, or once the processing is
+// stopped and all the running workers are done. It returns the first error of
+// the workers, or the error of the context.
+func (ch *BatchingChannel[T, B]) ProcessOut(f func(B) error) error {
 	for val := range ch.Out() {
 		if err := ch.sem.Acquire(ch.dCtx, 1); err != nil {
-			return err
+			// the processing is stopped, the output is closed soon.
+			continue
 		}
 		val := val
 		ch.g.Go(func() error {
@@ -73,45 +162,77 @@ func (ch *BatchingChannel) ProcessOut(f func(vector.Vector) error) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	// batches may have been dropped.
+	return ch.ctx.Err()
 }
 
-func (ch *BatchingChannel) Len() int {
-	return ch.size
+// Len returns the number of values in the batch being collected.
+func (ch *BatchingChannel[T, B]) Len() int {
+	return int(atomic.LoadInt64(&ch.fill))
 }
 
-func (ch *BatchingChannel) Cap() int {
+// Cap returns the number of values of a full batch.
+func (ch *BatchingChannel[T, B]) Cap() int {
 	return ch.size
 }
 
-func (ch *BatchingChannel) Close() {
+// Close tells no more values are sent. It must be called once, even when the
+// processing is stopped.
+func (ch *BatchingChannel[T, B]) Close() {
 	close(ch.input)
 }
 
-func (ch *BatchingChannel) batchingBuffer(ctx context.Context) {
-	ch.buffer = ch.allocate.Vector(ch.size, ch.allocate.Key)
+// batchingBuffer collects the values of the input into batches sent to the
+// output. It stops as soon as the processing is stopped.
+func (ch *BatchingChannel[T, B]) batchingBuffer() {
+	buffer := ch.batcher.New(ch.size)
 	defer close(ch.output)
-	for elem := range ch.input {
+	row := 0
+	for {
+		var elem T
+		var ok bool
 		select {
-		case <-ctx.Done():
-			ch.g.Go(func() error {
-				return ctx.Err()
-			})
+		case <-ch.dCtx.Done():
 			return
-		default:
+		case elem, ok = <-ch.input:
+		}
+		if !ok {
+			break
+		}
+		row++
+		var err error
+		buffer, err = ch.batcher.Push(buffer, elem)
+		if err == nil {
+			atomic.AddInt64(&ch.fill, 1)
+		} else if ch.reject != nil {
+			err = ch.reject(row, elem, err)
 		}
-		err := ch.buffer.PushBack(elem)
 		if err != nil {
 			ch.g.Go(func() error {
 				return err
 			})
+			return
 		}
-		if ch.buffer.Len() == ch.size {
-			ch.output <- ch.buffer
-			ch.buffer = ch.allocate.Vector(ch.size, ch.allocate.Key)
+		if ch.Len() == ch.size {
+			if !ch.send(buffer) {
+				return
+			}
+			buffer = ch.batcher.New(ch.size)
 		}
 	}
-	if ch.buffer.Len() > 0 {
-		ch.output <- ch.buffer
+	if ch.Len() > 0 {
+		ch.send(buffer)
+	}
+}
+
+// send sends the batch to the output and resets the fill. It returns false if
+// the processing is stopped first.
+func (ch *BatchingChannel[T, B]) send(batch B) bool {
+	select {
+	case ch.output <- batch:
+		atomic.StoreInt64(&ch.fill, 0)
+		return true
+	case <-ch.dCtx.Done():
+		return false
 	}
 }
@@ -2,8 +2,10 @@ package batchingchannels_test
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/askiada/external-sort/vector/key"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
 type Int struct {
@@ -33,7 +36,7 @@ func (k *Int) Get() int {
 func (k *Int) Less(other key.Key) bool {
 	return k.value < other.(*Int).value
 }
-func testBatches(t *testing.T, ch *batchingchannels.BatchingChannel) {
+func testBatches(t *testing.T, ch *batchingchannels.VectorChannel) {
 	maxI := 10000
 	expectedSum := (maxI - 1) * maxI / 2
 	wg := &sync.WaitGroup{}
@@ -110,7 +113,7 @@ func TestBatchingChannelCap(t *testing.T) {
 	}
 }
 
-func testChannelConcurrentAccessors(t *testing.T, name string, ch *batchingchannels.BatchingChannel) {
+func testChannelConcurrentAccessors(t *testing.T, name string, ch *batchingchannels.VectorChannel) {
 	// no asserts here, this is just for the race detector's benefit
 	go ch.Len()
 	go ch.Cap()
@@ -123,3 +126,138 @@ func testChannelConcurrentAccessors(t *testing.T, name string, ch *batchingchann
 		<-ch.Out()
 	}()
 }
+
+// sendAll sends values until the channel stops them, then closes it. It
+// returns the number of values sent.
+func sendAll(ch *batchingchannels.VectorChannel, values int) <-chan int {
+	sent := make(chan int, 1)
+	go func() {
+		defer ch.Close()
+		i := 0
+		for ; i < values; i++ {
+			if ch.Send(strconv.Itoa(i)) != nil {
+				break
+			}
+		}
+		sent <- i
+	}()
+	return sent
+}
+
+func TestBatchingChannelInvalid(t *testing.T) {
+	allocate := vector.DefaultVector(key.AllocateInt)
+	_, err := batchingchannels.NewBatchingChannel(context.Background(), allocate, 2, 0)
+	assert.Error(t, err)
+	_, err = batchingchannels.NewBatchingChannel(context.Background(), allocate, 0, 10)
+	assert.Error(t, err)
+}
+
+func TestBatchingChannelWorkerError(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	allocate := vector.DefaultVector(AllocateInt)
+	ch, err := batchingchannels.NewBatchingChannel(context.Background(), allocate, 2, 10)
+	require.NoError(t, err)
+	sent := sendAll(ch, 100000)
+	errWorker := errors.New("worker failed")
+	err = ch.ProcessOut(func(vector.Vector) error {
+		return errWorker
+	})
+	assert.ErrorIs(t, err, errWorker)
+	assert.Less(t, <-sent, 100000)
+}
+
+func TestBatchingChannelRejectError(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	allocate := vector.DefaultVector(AllocateInt)
+	ch, err := batchingchannels.NewBatchingChannel(context.Background(), allocate, 2, 10)
+	require.NoError(t, err)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		defer ch.Close()
+		for _, value := range []string{"1", "x", "2", "3"} {
+			if ch.Send(value) != nil {
+				return
+			}
+		}
+	}()
+	err = ch.ProcessOut(func(vector.Vector) error {
+		return nil
+	})
+	assert.Error(t, err)
+	<-sent
+}
+
+func TestBatchingChannelCancel(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	allocate := vector.DefaultVector(AllocateInt)
+	ch, err := batchingchannels.NewBatchingChannel(ctx, allocate, 2, 10)
+	require.NoError(t, err)
+	sent := sendAll(ch, 100000)
+	batches := int32(0)
+	err = ch.ProcessOut(func(vector.Vector) error {
+		if atomic.AddInt32(&batches, 1) == 5 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, <-sent, 100000)
+}
+
+func TestBatchingChannelGeneric(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	batcher := batchingchannels.Batcher[int, []int]{
+		New: func(size int) []int {
+			return make([]int, 0, size)
+		},
+		Push: func(batch []int, value int) ([]int, error) {
+			return append(batch, value), nil
+		},
+	}
+	ch, err := batchingchannels.New(context.Background(), batcher, 2, 3)
+	require.NoError(t, err)
+	go func() {
+		defer ch.Close()
+		for i := 0; i < 10; i++ {
+			if ch.Send(i) != nil {
+				return
+			}
+		}
+	}()
+	mu := sync.Mutex{}
+	sum, batches := 0, 0
+	err = ch.ProcessOut(func(batch []int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches++
+		for _, value := range batch {
+			sum += value
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 45, sum)
+	assert.Equal(t, 4, batches)
+}
+
+func TestBatchingChannelLen(t *testing.T) {
+	allocate := vector.DefaultVector(AllocateInt)
+	ch, err := batchingchannels.NewBatchingChannel(context.Background(), allocate, 2, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ch.Len())
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ch.Send(strconv.Itoa(i)))
+	}
+	assert.Eventually(t, func() bool {
+		return ch.Len() == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 5, ch.Cap())
+	ch.Close()
+	require.NoError(t, ch.ProcessOut(func(vector.Vector) error {
+		return nil
+	}))
+	assert.Equal(t, 0, ch.Len())
+}
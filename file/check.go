@@ -0,0 +1,74 @@
+package file
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/askiada/external-sort/file/record"
+	"github.com/askiada/external-sort/vector"
+	"github.com/pkg/errors"
+)
+
+// UnsortedError is returned by CheckSorted when a row is smaller than the row
+// before it. The error describes the keys of both rows when they implement
+// fmt.Stringer, and the rows otherwise.
+type UnsortedError struct {
+	Previous *vector.Element
+	Current  *vector.Element
+	// Line is the 1-based line number of Current in the input.
+	Line int
+}
+
+func (e *UnsortedError) Error() string {
+	current, ok1 := e.Current.Key.(fmt.Stringer)
+	previous, ok2 := e.Previous.Key.(fmt.Stringer)
+	if ok1 && ok2 {
+		return fmt.Sprintf("line %d is out of order: key %q sorts before key %q of the previous line",
+			e.Line, current.String(), previous.String())
+	}
+	return fmt.Sprintf("line %d is out of order: %q sorts before %q", e.Line, e.Current.Line, e.Previous.Line)
+}
+
+// Unwrap returns ErrNotSorted so the error can be checked with errors.Is.
+func (e *UnsortedError) Unwrap() error {
+	return ErrNotSorted
+}
+
+// CheckSorted reads the input in one pass and checks it is sorted according
+// to the keys of allocate, in descending order if it is reversed. It returns
+// an *UnsortedError describing the first row out of order, or an error if a
+// key can't be allocated. The rows are read as record.Lines.
+func CheckSorted(r io.Reader, allocate *vector.Allocate) error {
+	return CheckSortedFormat(r, record.Lines, allocate)
+}
+
+// CheckSortedFormat is like CheckSorted but reads the records with the format.
+func CheckSortedFormat(r io.Reader, format record.Format, allocate *vector.Allocate) error {
+	if r == nil {
+		return ErrNoInput
+	}
+	if allocate == nil {
+		return ErrNoAllocator
+	}
+	scanner := format.NewReader(r)
+	var prev *vector.Element
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		k, err := allocate.Key(text)
+		if err != nil {
+			return errors.Wrapf(err, "allocating key on line %d", line)
+		}
+		curr := &vector.Element{Key: k, Line: text}
+		if prev != nil && allocate.Less(curr, prev) {
+			return &UnsortedError{
+				Previous: prev,
+				Current:  curr,
+				Line:     line,
+			}
+		}
+		prev = curr
+	}
+	return errors.Wrap(scanner.Err(), "error while scanning")
+}
@@ -1,87 +1,165 @@
 package file
 
 import (
-	"bufio"
-	"os"
+	"compress/gzip"
+	"io"
 	"sort"
 
-	"github.com/askiada/external-sort/vector"
-
-	"github.com/pkg/errors"
+	"github.com/askiada/external-sort/file/record"
+	"github.com/askiada/external-sort/vector/typed"
 )
 
 // chunkInfo Describe a chunk.
-type chunkInfo struct {
-	file     *os.File
-	scanner  *bufio.Scanner
-	buffer   vector.Vector
-	filename string
+type chunkInfo[K any] struct {
+	file    io.Closer
+	scanner record.Reader
+	buffer  typed.Vector[K]
+	// store is nil when the chunk has not been created by us and must not be
+	// removed.
+	store ChunkStore
+	// name identifies the chunk in the store.
+	name string
+	// path describes the chunk in errors, see chunkPath.
+	path string
+	// row is the number of lines read from the chunk.
+	row int
 }
 
 // pullSubset Add to vector the specified number of elements.
 // It stops if there is no elements left to add.
-func (c *chunkInfo) pullSubset(size int) (err error) {
+func (c *chunkInfo[K]) pullSubset(size int) (err error) {
 	i := 0
 	for i < size && c.scanner.Scan() {
+		c.row++
 		text := c.scanner.Text()
-		c.buffer.PushBack(text)
+		err = c.buffer.PushBack(text)
+		if err != nil {
+			return c.error(err)
+		}
 		i++
 	}
 	if c.scanner.Err() != nil {
-		return c.scanner.Err()
+		return c.error(c.scanner.Err())
 	}
 	return nil
 }
 
+// error Describe an error that happened while merging the chunk.
+func (c *chunkInfo[K]) error(err error) error {
+	return &SortError{
+		Phase: PhaseMerging,
+		Chunk: c.path,
+		Line:  c.row,
+		Err:   err,
+	}
+}
+
 // chunks Pull of chunks.
-type chunks struct {
-	list []*chunkInfo
+type chunks[K any] struct {
+	// store holds the chunks created with new.
+	store ChunkStore
+	// format frames the records of the chunks.
+	format record.Format
+	// less compares the first elements of the chunks.
+	less func(v1, v2 *typed.Element[K]) bool
+	list []*chunkInfo[K]
+	// compressed tells the chunks of the store are compressed with gzip.
+	compressed bool
+	// keep tells the chunks of the store must not be removed once empty.
+	keep bool
 }
 
-// new Create a new chunk and initialize it.
-func (c *chunks) new(chunkPath string, allocate *vector.Allocate, size int) error {
-	f, err := os.Open(chunkPath)
+// new Create a new chunk from the store and initialize it. A compressed chunk
+// is read through a gzip reader.
+func (c *chunks[K]) new(name string, allocate typed.Allocator[K], size int) error {
+	path := chunkPath(c.store, name)
+	f, err := c.store.Open(name)
 	if err != nil {
-		return err
+		return &SortError{Phase: PhaseMerging, Chunk: path, Err: err}
 	}
-	scanner := bufio.NewScanner(f)
-	elem := &chunkInfo{
-		filename: chunkPath,
-		file:     f,
-		scanner:  scanner,
-		buffer:   allocate.Vector(size, allocate.Key),
+	var r io.Reader = f
+	if c.compressed {
+		r, err = gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return &SortError{Phase: PhaseMerging, Chunk: path, Err: err}
+		}
+	}
+	elem := &chunkInfo[K]{
+		name:    name,
+		path:    path,
+		file:    f,
+		scanner: c.format.NewReader(r),
 	}
-	err = elem.pullSubset(size)
+	if !c.keep {
+		elem.store = c.store
+	}
+	return c.add(elem, allocate, size)
+}
+
+// newFromReader Create a new chunk from an already sorted reader and
+// initialize it. The reader is never closed nor removed.
+func (c *chunks[K]) newFromReader(name string, r io.Reader, allocate typed.Allocator[K], size int) error {
+	return c.add(&chunkInfo[K]{
+		name:    name,
+		path:    name,
+		scanner: c.format.NewReader(r),
+	}, allocate, size)
+}
+
+// add Fill the buffer of the chunk and add it to the list. An empty chunk is
+// released straight away.
+func (c *chunks[K]) add(elem *chunkInfo[K], allocate typed.Allocator[K], size int) error {
+	elem.buffer = allocate.NewVector(size)
+	err := elem.pullSubset(size)
 	if err != nil {
 		return err
 	}
+	if elem.buffer.Len() == 0 {
+		err = elem.release()
+		if err != nil {
+			return elem.error(err)
+		}
+		return nil
+	}
 	c.list = append(c.list, elem)
 	return nil
 }
 
-// close Close the file descriptors of all the chunks.
-func (c *chunks) close() error {
+// release Close the file descriptor of the chunk and remove it from the store
+// if we created it. It does nothing once the chunk is released.
+func (c *chunkInfo[K]) release() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	if err != nil {
+		return err
+	}
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Remove(c.name)
+}
+
+// close Release all the chunks left, after a failure or once merged. Errors
+// are ignored as the chunks left are not needed anymore.
+func (c *chunks[K]) close() {
 	for _, chunk := range c.list {
-		err := chunk.file.Close()
-		if err != nil {
-			return errors.Wrap(err, "close")
-		}
+		_ = chunk.release()
 	}
-	return nil
+	c.list = nil
 }
 
 // shrink Remove all the chunks at the specified indexes
 // it removes the local file created and close the file descriptor.
-func (c *chunks) shrink(toShrink []int) error {
+func (c *chunks[K]) shrink(toShrink []int) error {
 	for i, shrinkIndex := range toShrink {
 		shrinkIndex -= i
-		err := c.list[shrinkIndex].file.Close()
-		if err != nil {
-			return err
-		}
-		err = os.Remove(c.list[shrinkIndex].filename)
+		err := c.list[shrinkIndex].release()
 		if err != nil {
-			return err
+			return c.list[shrinkIndex].error(err)
 		}
 		// we want to preserve order
 		c.list = append(c.list[:shrinkIndex], c.list[shrinkIndex+1:]...)
@@ -90,33 +168,33 @@ func (c *chunks) shrink(toShrink []int) error {
 }
 
 // len total number of chunks.
-func (c *chunks) len() int {
+func (c *chunks[K]) len() int {
 	return len(c.list)
 }
 
 // resetOrder Put all the chunks in ascending order
 // Compare the first element of each chunk.
-func (c *chunks) resetOrder() {
+func (c *chunks[K]) resetOrder() {
 	if len(c.list) > 1 {
 		sort.Slice(c.list, func(i, j int) bool {
-			return vector.Less(c.list[i].buffer.Get(0), c.list[j].buffer.Get(0))
+			return c.less(c.list[i].buffer.Get(0), c.list[j].buffer.Get(0))
 		})
 	}
 }
 
 // moveFirstChunkToCorrectIndex Check where the first chunk should using the first value in the buffer.
-func (c *chunks) moveFirstChunkToCorrectIndex() {
+func (c *chunks[K]) moveFirstChunkToCorrectIndex() {
 	elem := c.list[0]
 	c.list = c.list[1:]
 	pos := sort.Search(len(c.list), func(i int) bool {
-		return !vector.Less(c.list[i].buffer.Get(0), elem.buffer.Get(0))
+		return !c.less(c.list[i].buffer.Get(0), elem.buffer.Get(0))
 	})
 	// TODO: c.list = c.list[1:] and the following line create an unecessary allocation.
-	c.list = append(c.list[:pos], append([]*chunkInfo{elem}, c.list[pos:]...)...)
+	c.list = append(c.list[:pos], append([]*chunkInfo[K]{elem}, c.list[pos:]...)...)
 }
 
 // min Check all the first elements of all the chunks and returns the smallest value.
-func (c *chunks) min() (minChunk *chunkInfo, minValue *vector.Element, minIdx int) {
+func (c *chunks[K]) min() (minChunk *chunkInfo[K], minValue *typed.Element[K], minIdx int) {
 	minValue = c.list[0].buffer.Get(0)
 	minIdx = 0
 	minChunk = c.list[0]
@@ -1,6 +1,11 @@
 package file
 
-import "github.com/pkg/errors"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 var (
 	// ErrNoInput is returned when no input is provided.
@@ -14,4 +19,79 @@ var (
 
 	// ErrNoAllocator is returned when the allocator is not provided.
 	ErrNoAllocator = errors.New("allocator is not provided")
+
+	// ErrNoQuarantine is returned when the quarantine policy is used without a
+	// quarantine writer.
+	ErrNoQuarantine = errors.New("quarantine is not provided")
+
+	// ErrTempLimit is returned when the chunks exceed, or would exceed, the
+	// MaxTempBytes limit.
+	ErrTempLimit = errors.New("temporary storage limit exceeded")
+
+	// ErrNoSpace is returned when the chunk store doesn't have enough free
+	// space for the chunks.
+	ErrNoSpace = errors.New("not enough free space for the chunks")
+
+	// ErrNoCodec is returned when the codec of a Sorter is not provided.
+	ErrNoCodec = errors.New("codec is not provided")
+
+	// ErrNoLess is returned when the comparison of a Sorter is not provided.
+	ErrNoLess = errors.New("less function is not provided")
+
+	// ErrNotSorted is returned when the input is not sorted.
+	ErrNotSorted = errors.New("input is not sorted")
 )
+
+// Phase is the stage of the sort where an error happened.
+type Phase string
+
+const (
+	// PhaseChunking is the stage reading the input and splitting it into
+	// chunks.
+	PhaseChunking Phase = "chunking"
+	// PhaseDumping is the stage writing the sorted chunks.
+	PhaseDumping Phase = "dumping"
+	// PhaseMerging is the stage merging the chunks into the output.
+	PhaseMerging Phase = "merging"
+)
+
+// SortError describes an error that happened while sorting. Use errors.As to
+// access it, and errors.Is with a SortError holding only a Phase to check the
+// stage where it happened.
+type SortError struct {
+	// Err is the underlying cause.
+	Err   error
+	Phase Phase
+	// Chunk is the path of the chunk, or its name in the store when the store
+	// is not on disk, or the input when merging inputs, being processed. It is
+	// empty when the error is not related to a chunk.
+	Chunk string
+	// Line is the line number, starting at 1, in the input when chunking, or
+	// in the chunk otherwise. It is 0 when the error is not related to a line.
+	Line int
+}
+
+func (e *SortError) Error() string {
+	str := &strings.Builder{}
+	str.WriteString(string(e.Phase))
+	if e.Chunk != "" {
+		str.WriteString(": chunk " + e.Chunk)
+	}
+	if e.Line > 0 {
+		str.WriteString(": line " + strconv.Itoa(e.Line))
+	}
+	str.WriteString(": " + e.Err.Error())
+	return str.String()
+}
+
+// Unwrap returns the underlying cause.
+func (e *SortError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is a *SortError with the same phase, or no
+// phase.
+func (e *SortError) Is(target error) bool {
+	t, ok := target.(*SortError) // nolint:errorlint // errors.Is unwraps the target already.
+	return ok && (t.Phase == "" || t.Phase == e.Phase)
+}
@@ -2,38 +2,76 @@
 package file
 
 import (
-	"bufio"
+	"compress/gzip"
 	"context"
 	"io"
-	"path"
 	"strconv"
-	"sync"
 
-	"github.com/askiada/external-sort/file/batchingchannels"
+	"github.com/askiada/external-sort/file/record"
 	"github.com/askiada/external-sort/vector"
+	"github.com/askiada/external-sort/vector/key"
 	"github.com/pkg/errors"
 )
 
 // Info sorts the Input with the external-sort algorithm and writes the sorted
-// results into the Output. It requires the ChunkFolder for creating temporary
-// files in order to reduce the memory size. In order to sort the Input you
-// only need to call the Sort method. If you want a fine-grained control over
-// the chunks, you can call the CreateSortedChunks and follow by a MergeSort
-// call.
+// results into the Output. It requires the ChunkFolder, or a ChunkStore, for
+// creating temporary files in order to reduce the memory size. In order to
+// sort the Input you only need to call the Sort method. If you want a
+// fine-grained control over the chunks, you can call the CreateSortedChunks
+// and follow by a MergeSort call.
 type Info struct {
-	Input       io.Reader
-	Output      io.Writer
+	Input  io.Reader
+	Output io.Writer
+	// ChunkFolder is the parent of the unique folder created for the chunks
+	// of each run. Nothing else in it is ever modified.
 	ChunkFolder string
-	Allocate    *vector.Allocate
+	// ChunkStore stores the chunks. It defaults to a RunStore in the
+	// ChunkFolder.
+	ChunkStore ChunkStore
+	Allocate   *vector.Allocate
+	// Keys orders the rows instead of the Allocate, see TypedKeys.
+	Keys Keys
+	// Format frames the records of the Input, the chunks and the Output. It
+	// defaults to record.Lines.
+	Format record.Format
+	// Quarantine receives the invalid rows with the ErrorPolicyQuarantine
+	// policy, one per line as: line number, quoted reason and row separated by
+	// tabs.
+	Quarantine io.Writer
+	// ErrorPolicy tells how rows whose key can't be allocated are handled. It
+	// defaults to ErrorPolicyFail.
+	ErrorPolicy ErrorPolicy
+	// MaxTempBytes limits the number of bytes written to the chunks. The sort
+	// fails with ErrTempLimit when it is exceeded, or before creating any
+	// chunk when the size of the input already exceeds it. The chunks are
+	// neither compressed nor merged sooner to stay under the limit. 0 means no
+	// limit.
+	MaxTempBytes int64
+	// CompressChunks compresses the chunk files with gzip. It trades CPU for
+	// less disk usage.
+	CompressChunks bool
+	// KeepChunks keeps the chunks once merged, for debugging.
+	KeepChunks bool
+	// NoProgress disables the progress bar drawn on stderr while merging.
+	NoProgress bool
+	// Shuffle shuffles the Input instead of sorting it with the Allocate,
+	// which is then not required.
+	Shuffle *Shuffle
+	// memChunk holds the only chunk when the whole input fits in memory.
+	memChunk    lines
+	store       ChunkStore
+	tempBytes   int64
 	totalRows   int
-	chunkPaths  []string
+	skippedRows int
+	chunkNames  []string
 }
 
 // Sort sorts the file on disk using external sort algorithm. It returns an
 // error if any of the exported properties of the Info is not provided, or an
 // error during the operation occurred. The bufferSize is the amount of buffer
 // we keep in memory per each chunk file to avoid loading the entire chunk when
-// merging. Each chunk contains at most chunkSize lines.
+// merging. Each chunk contains at most chunkSize lines. It stops once the
+// context is cancelled, during the chunking or the merge.
 func (i *Info) Sort(ctx context.Context, chunkSize, workers, bufferSize int) error {
 	if i.Input == nil {
 		return ErrNoInput
@@ -41,73 +79,176 @@ func (i *Info) Sort(ctx context.Context, chunkSize, workers, bufferSize int) err
 	if i.Output == nil {
 		return ErrNoOutput
 	}
-	if i.ChunkFolder == "" {
+	if i.ChunkFolder == "" && i.ChunkStore == nil {
 		return ErrNoChunkFolder
 	}
-	if i.Allocate == nil {
+	if i.Allocate == nil && i.Keys == nil && i.Shuffle == nil {
 		return ErrNoAllocator
 	}
+	if bufferSize <= 0 {
+		return errors.New("buffer size must be greater than 0")
+	}
 
 	err := i.CreateSortedChunks(ctx, chunkSize, int64(workers))
 	if err != nil {
 		return errors.Wrap(err, "creating chunks")
 	}
-	return i.MergeSort(bufferSize)
+	return i.MergeSortContext(ctx, bufferSize)
 }
 
 // CreateSortedChunks Scan a file and divide it into small sorted chunks. It
-// returns an error if it can't create chunkFolder.
-func (i *Info) CreateSortedChunks(ctx context.Context, dumpSize int, maxWorkers int64) error {
+// returns an error if it can't create chunkFolder. Once the context is
+// cancelled it returns without waiting for a pending Read of the Input.
+func (i *Info) CreateSortedChunks(ctx context.Context, dumpSize int, maxWorkers int64) (err error) {
 	if dumpSize <= 0 {
 		return errors.New("dump size must be greater than 0")
 	}
+	if i.ErrorPolicy == ErrorPolicyQuarantine && i.Quarantine == nil {
+		return ErrNoQuarantine
+	}
 
-	err := clearChunkFolder(i.ChunkFolder)
-	if err != nil {
-		return errors.Wrap(err, "cleaning chunk folder")
-	}
-	row := 0
-	scanner := bufio.NewScanner(i.Input)
-	mu := sync.Mutex{}
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	batchChan, err := batchingchannels.NewBatchingChannel(ctx, i.Allocate, maxWorkers, dumpSize)
-	if err != nil {
-		return errors.Wrap(err, "creating batching channel")
-	}
-	go func() {
-		defer wg.Done()
-		for scanner.Scan() {
-			text := scanner.Text()
-			batchChan.In() <- text
-			row++
+	i.store = i.ChunkStore
+	if i.store == nil {
+		// nothing is written in the ChunkFolder if the input fits in memory.
+		i.store = NewLazyStore(func() (ChunkStore, error) {
+			return NewRunStore(i.ChunkFolder)
+		})
+	}
+	defer func() {
+		if err != nil {
+			i.discard()
 		}
-		batchChan.Close()
 	}()
+	return i.keys().createSortedChunks(ctx, i, dumpSize, maxWorkers)
+}
 
-	chunkIdx := 0
-	err = batchChan.ProcessOut(func(v vector.Vector) error {
-		mu.Lock()
-		chunkIdx++
-		chunkPath := path.Join(i.ChunkFolder, "chunk_"+strconv.Itoa(chunkIdx)+".tsv")
-		mu.Unlock()
-		v.Sort()
-		err := vector.Dump(v, chunkPath)
-		if err != nil {
-			return errors.Wrap(err, "dumping vector")
-		}
-		mu.Lock()
-		i.chunkPaths = append(i.chunkPaths, chunkPath)
-		mu.Unlock()
+// cleanup releases the chunk store if it was created for this run.
+func (i *Info) cleanup() error {
+	cleaner, ok := i.store.(Cleaner)
+	if !ok {
 		return nil
-	})
+	}
+	return errors.Wrap(cleaner.Cleanup(i.KeepChunks), "cleaning chunks")
+}
+
+// keys returns the keys ordering the rows: the shuffle keys when shuffling,
+// the Keys if set and the keys of the Allocate otherwise.
+func (i *Info) keys() Keys {
+	switch {
+	case i.Shuffle != nil:
+		return TypedKeys(i.Shuffle.allocate())
+	case i.Keys != nil:
+		return i.Keys
+	default:
+		return TypedKeys[key.Key](i.Allocate)
+	}
+}
+
+// outputWriter returns the writer of the Output, removing the random keys
+// prefixed to the rows when shuffling.
+func (i *Info) outputWriter() record.Writer {
+	w := i.format().NewWriter(i.Output)
+	if i.Shuffle != nil && i.Shuffle.random() {
+		return &unprefixWriter{w}
+	}
+	return w
+}
+
+// format returns the format of the records.
+func (i *Info) format() record.Format {
+	if i.Format == nil {
+		return record.Lines
+	}
+	return i.Format
+}
+
+// discard removes the chunks left in the store after a failure, unless
+// KeepChunks is set, and releases the store. Errors are ignored as the failure
+// is the one reported.
+func (i *Info) discard() {
+	if !i.KeepChunks {
+		for _, chunkName := range i.chunkNames {
+			_ = i.store.Remove(chunkName)
+		}
+	}
+	i.chunkNames = nil
+	i.memChunk = nil
+	_ = i.cleanup()
+}
+
+// chunkName returns the name of the chunk with the given index.
+func (i *Info) chunkName(idx int) string {
+	ext := ".tsv"
+	if i.CompressChunks {
+		ext += ".gz"
+	}
+	return "chunk_" + strconv.Itoa(idx) + ext
+}
+
+// dump writes the vector to the chunk, compressed if required. It returns a
+// *SortError in the PhaseDumping phase.
+func (i *Info) dump(v lines, chunkName string) error {
+	err := i.dumpChunkFile(v, chunkName)
+	if err != nil {
+		path := chunkPath(i.store, chunkName)
+		// the partial chunk is useless.
+		_ = i.store.Remove(chunkName)
+		return &SortError{Phase: PhaseDumping, Chunk: path, Err: err}
+	}
+	return nil
+}
+
+func (i *Info) dumpChunkFile(v lines, chunkName string) error {
+	f, err := i.store.Create(chunkName)
+	if err != nil {
+		return errors.Wrap(err, "failed creating chunk")
+	}
+	defer f.Close()
+	var w io.Writer = &limitWriter{w: f, info: i}
+	var gz *gzip.Writer
+	if i.CompressChunks {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	records := i.format().NewWriter(w)
+	err = writeRecords(records, v)
+	if err == nil {
+		err = records.Flush()
+	}
 	if err != nil {
-		return errors.Wrap(err, "processing batches")
+		return errors.Wrap(err, "failed writing chunk")
+	}
+	if gz != nil {
+		err = gz.Close()
+		if err != nil {
+			return errors.Wrap(err, "failed writing chunk")
+		}
 	}
-	wg.Wait()
-	if scanner.Err() != nil {
-		return errors.Wrap(scanner.Err(), "error while scanning")
+	return errors.Wrap(f.Close(), "failed closing chunk")
+}
+
+// dumpChunk writes the sorted vector to a new chunk. It must not be called
+// concurrently.
+func (i *Info) dumpChunk(v lines) error {
+	chunkName := i.chunkName(len(i.chunkNames) + 1)
+	err := i.dump(v, chunkName)
+	if err != nil {
+		return err
 	}
-	i.totalRows = row
+	i.chunkNames = append(i.chunkNames, chunkName)
 	return nil
 }
+
+// ChunkNames returns the names in the chunk store of the sorted chunks
+// created by CreateSortedChunks. If the input fitted in memory, the chunk is
+// written to the store first.
+func (i *Info) ChunkNames() ([]string, error) {
+	if i.memChunk != nil {
+		err := i.dumpChunk(i.memChunk)
+		if err != nil {
+			return nil, err
+		}
+		i.memChunk = nil
+	}
+	return i.chunkNames, nil
+}
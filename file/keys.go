@@ -0,0 +1,186 @@
+package file
+
+import (
+	"context"
+	"sync"
+
+	"github.com/askiada/external-sort/file/batchingchannels"
+	"github.com/askiada/external-sort/file/record"
+	"github.com/askiada/external-sort/vector/typed"
+	"github.com/cheggaaa/pb/v3"
+	"github.com/pkg/errors"
+)
+
+// Keys orders the rows of an Info with keys of any type. Use TypedKeys to sort
+// with a typed.Allocator instead of the Allocate of the Info.
+type Keys interface {
+	createSortedChunks(ctx context.Context, i *Info, dumpSize int, maxWorkers int64) error
+	mergeSort(ctx context.Context, i *Info, k int) error
+}
+
+// TypedKeys returns the Keys of the vectors created by allocate. The keys are
+// compared by the allocator without being boxed in key.Key interfaces.
+func TypedKeys[K any](allocate typed.Allocator[K]) Keys {
+	return &allocatorKeys[K]{allocate: allocate}
+}
+
+// allocatorKeys sorts with the typed keys of an allocator.
+type allocatorKeys[K any] struct {
+	allocate typed.Allocator[K]
+}
+
+// createSortedChunks is the body of Info.CreateSortedChunks.
+func (a *allocatorKeys[K]) createSortedChunks(ctx context.Context, i *Info, dumpSize int, maxWorkers int64) error {
+	allocate := a.allocate
+	inputSize, sized := inputSize(i.Input)
+	row := 0
+	scanner := i.format().NewReader(i.Input)
+	var prefix func(line string) string
+	if i.Shuffle != nil && i.Shuffle.random() {
+		prefix = i.Shuffle.newPrefixer()
+	}
+	mu := sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	batchChan, err := batchingchannels.New(ctx, batchingchannels.AllocatorBatcher(allocate), maxWorkers, dumpSize,
+		batchingchannels.WithReject(i.rejectRow))
+	if err != nil {
+		return errors.Wrap(err, "creating batching channel")
+	}
+	go func() {
+		defer wg.Done()
+		defer batchChan.Close()
+		for scanner.Scan() {
+			line := scanner.Text()
+			if prefix != nil {
+				line = prefix(line)
+			}
+			// the error that stopped the processing is returned by ProcessOut.
+			if batchChan.Send(line) != nil {
+				return
+			}
+			row++
+		}
+	}()
+
+	chunkIdx := 0
+	// The first batch is kept in memory until a second one arrives, as it is
+	// the only chunk when the input fits in one batch.
+	var firstChunk typed.Vector[K]
+	err = batchChan.ProcessOut(func(v typed.Vector[K]) error {
+		allocate.Sort(v)
+		mu.Lock()
+		if chunkIdx == 0 && firstChunk == nil {
+			firstChunk = v
+			mu.Unlock()
+			return nil
+		}
+		batches := []typed.Vector[K]{v}
+		if firstChunk != nil {
+			batches = append(batches, firstChunk)
+			firstChunk = nil
+		}
+		chunkNames := make([]string, len(batches))
+		for idx := range batches {
+			chunkIdx++
+			chunkNames[idx] = i.chunkName(chunkIdx)
+		}
+		mu.Unlock()
+		if len(batches) > 1 {
+			// the input doesn't fit in memory, the first chunks are dumped.
+			err := i.preflight(inputSize, sized)
+			if err != nil {
+				return err
+			}
+		}
+		for idx, batch := range batches {
+			err := i.dump(vectorLines[K]{batch}, chunkNames[idx])
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			i.chunkNames = append(i.chunkNames, chunkNames[idx])
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		// the scanner may be blocked reading a quiet input, it stops once its
+		// Read returns.
+		return errors.Wrap(err, "processing batches")
+	}
+	wg.Wait()
+	if scanner.Err() != nil {
+		return &SortError{Phase: PhaseChunking, Line: row + 1, Err: errors.Wrap(scanner.Err(), "error while scanning")}
+	}
+	if firstChunk != nil {
+		i.memChunk = vectorLines[K]{firstChunk}
+	}
+	i.totalRows = row - i.skippedRows
+	return nil
+}
+
+// mergeSort merges the chunks of the Info, which are not in memory.
+func (a *allocatorKeys[K]) mergeSort(ctx context.Context, i *Info, k int) error {
+	chunks := &chunks[K]{
+		list:       make([]*chunkInfo[K], 0, len(i.chunkNames)),
+		store:      i.store,
+		format:     i.format(),
+		less:       a.allocate.Less,
+		compressed: i.CompressChunks,
+		keep:       i.KeepChunks,
+	}
+	for _, chunkName := range i.chunkNames {
+		err := chunks.new(chunkName, a.allocate, k)
+		if err != nil {
+			chunks.close()
+			return errors.Wrap(err, "failed to create chunk")
+		}
+	}
+
+	bar := pb.New(i.totalRows)
+	if !i.NoProgress {
+		bar.Start()
+	}
+	err := mergeChunks(ctx, chunks, i.outputWriter(), a.allocate, k, bar)
+	bar.Finish()
+	chunks.close()
+	return err
+}
+
+// lines gives access to the lines of a vector, whatever the type of its keys.
+type lines interface {
+	Len() int
+	Line(i int) string
+	Reset()
+}
+
+// vectorLines are the lines of a typed vector.
+type vectorLines[K any] struct {
+	v typed.Vector[K]
+}
+
+func (l vectorLines[K]) Len() int {
+	return l.v.Len()
+}
+
+func (l vectorLines[K]) Line(i int) string {
+	return l.v.Get(i).Line
+}
+
+func (l vectorLines[K]) Reset() {
+	l.v.Reset()
+}
+
+// writeRecords writes the rows with the writer, without flushing it, and
+// resets the rows.
+func writeRecords(w record.Writer, rows lines) error {
+	for i := 0; i < rows.Len(); i++ {
+		err := w.Write(rows.Line(i))
+		if err != nil {
+			return err
+		}
+	}
+	rows.Reset()
+	return nil
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// inputSize returns the number of bytes left to read from the input when it
+// can be known without reading it.
+func inputSize(r io.Reader) (int64, bool) {
+	switch input := r.(type) {
+	case interface{ Len() int }:
+		return int64(input.Len()), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		stat, err := input.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			return 0, false
+		}
+		return stat.Size(), true
+	default:
+		return 0, false
+	}
+}
+
+// preflight checks the chunks will fit in the chunk store before creating
+// the first one, so it is skipped when the input fits in memory. The footprint
+// of the chunks is projected from the size of the input, read with inputSize
+// before the input, so nothing is checked if the size is unknown or the chunks
+// are compressed.
+func (i *Info) preflight(size int64, ok bool) error {
+	if !ok || i.CompressChunks {
+		return nil
+	}
+	if i.MaxTempBytes > 0 && size > i.MaxTempBytes {
+		return errors.Wrapf(ErrTempLimit, "the chunks need about %d bytes, the limit is %d bytes", size, i.MaxTempBytes)
+	}
+	return checkSpace(i.store, uint64(size))
+}
+
+// checkSpace checks size bytes of chunks fit in the store. The stores whose
+// free space is unknown are not checked.
+func checkSpace(store ChunkStore, size uint64) error {
+	switch s := store.(type) {
+	case *LazyStore:
+		created, err := s.get()
+		if err != nil {
+			return err
+		}
+		return checkSpace(created, size)
+	case *StripedStore:
+		return s.checkSpace(size)
+	}
+	spacer, ok := store.(FreeSpacer)
+	if !ok {
+		return nil
+	}
+	free, err := spacer.FreeSpace()
+	if err != nil {
+		// the free space can't be read on every platform.
+		return nil // nolint:nilerr // the check is best effort.
+	}
+	if size > free {
+		return errors.Wrapf(ErrNoSpace, "the chunks need about %d bytes, %d bytes are free", size, free)
+	}
+	return nil
+}
+
+// limitWriter counts the bytes written to the chunks and fails once the
+// MaxTempBytes limit is exceeded.
+type limitWriter struct {
+	w    io.Writer
+	info *Info
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	total := atomic.AddInt64(&l.info.tempBytes, int64(len(p)))
+	if l.info.MaxTempBytes > 0 && total > l.info.MaxTempBytes {
+		return 0, errors.Wrapf(ErrTempLimit, "the chunks need more than %d bytes", l.info.MaxTempBytes)
+	}
+	return l.w.Write(p)
+}
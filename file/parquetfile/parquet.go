@@ -0,0 +1,200 @@
+// Package parquetfile sorts the rows of Parquet files with the external-sort
+// algorithm of the file package.
+package parquetfile
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+)
+
+// rowBatch is the number of rows read from a row group at once.
+const rowBatch = 128
+
+// Sort reads the rows of the Parquet input, sorts them by the columns and
+// writes them to the output as a Parquet file with the same schema. A column
+// is the dot separated path of a leaf column that is not repeated, the rows
+// are compared on the next column when the previous ones are equal and null
+// values come first. The sorter configures the chunks and the merge, its Codec
+// and Less are set by Sort.
+func Sort(ctx context.Context, input io.ReaderAt, size int64, output io.Writer, columns []string, sorter file.Sorter[parquet.Row]) error {
+	f, err := parquet.OpenFile(input, size)
+	if err != nil {
+		return errors.Wrap(err, "opening parquet file")
+	}
+	less, err := NewLess(f.Schema(), columns)
+	if err != nil {
+		return err
+	}
+	sorter.Codec = RowCodec{}
+	sorter.Less = less
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	in := make(chan parquet.Row)
+	read := make(chan error, 1)
+	go func() {
+		defer close(in)
+		err := readRows(ctx, f, in)
+		if err != nil {
+			// the sort must not go on with part of the rows.
+			cancel()
+		}
+		read <- err
+	}()
+
+	writer := parquet.NewWriter(output, f.Schema())
+	err = sorter.Sort(ctx, in, func(row parquet.Row) error {
+		_, err := writer.WriteRows([]parquet.Row{row})
+		return err
+	})
+	// stop reading the rows left after a failure.
+	cancel()
+	if readErr := <-read; readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(writer.Close(), "writing parquet file")
+}
+
+// readRows sends the rows of each row group of f.
+func readRows(ctx context.Context, f *parquet.File, in chan<- parquet.Row) error {
+	buf := make([]parquet.Row, rowBatch)
+	for idx, rowGroup := range f.RowGroups() {
+		rows := rowGroup.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				select {
+				case <-ctx.Done():
+					rows.Close()
+					return nil
+				// the values of the row are reused by the next read.
+				case in <- row.Clone():
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return errors.Wrapf(err, "reading row group %d", idx)
+			}
+		}
+		err := rows.Close()
+		if err != nil {
+			return errors.Wrapf(err, "closing row group %d", idx)
+		}
+	}
+	return nil
+}
+
+// NewLess returns the comparison of the rows of the schema by the columns.
+func NewLess(schema *parquet.Schema, columns []string) (func(a, b parquet.Row) bool, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("no sort column provided")
+	}
+	indexes := make([]int, 0, len(columns))
+	types := make([]parquet.Type, 0, len(columns))
+	for _, column := range columns {
+		leaf, ok := schema.Lookup(strings.Split(column, ".")...)
+		if !ok {
+			return nil, errors.Errorf("unknown column %q", column)
+		}
+		if leaf.MaxRepetitionLevel > 0 {
+			return nil, errors.Errorf("repeated column %q can't be sorted", column)
+		}
+		indexes = append(indexes, leaf.ColumnIndex)
+		types = append(types, leaf.Node.Type())
+	}
+	return func(a, b parquet.Row) bool {
+		for i, idx := range indexes {
+			if c := compare(types[i], value(a, idx), value(b, idx)); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+// value returns the value of the column in the row.
+func value(row parquet.Row, column int) parquet.Value {
+	for _, v := range row {
+		if v.Column() == column {
+			return v
+		}
+	}
+	return parquet.NullValue()
+}
+
+// compare compares the values with null values first.
+func compare(t parquet.Type, a, b parquet.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	default:
+		return t.Compare(a, b)
+	}
+}
+
+// RowCodec encodes the rows in the chunks. Each value is written as its kind,
+// its levels, its column and its binary representation.
+type RowCodec struct{}
+
+func (RowCodec) Encode(row parquet.Row) ([]byte, error) {
+	data := make([]byte, 0, 16*len(row))
+	for _, v := range row {
+		kind := byte(0)
+		if !v.IsNull() {
+			kind = byte(v.Kind()) + 1
+		}
+		data = append(data, kind)
+		data = binary.AppendUvarint(data, uint64(v.RepetitionLevel()))
+		data = binary.AppendUvarint(data, uint64(v.DefinitionLevel()))
+		data = binary.AppendUvarint(data, uint64(v.Column()))
+		bytes := v.Bytes()
+		data = binary.AppendUvarint(data, uint64(len(bytes)))
+		data = append(data, bytes...)
+	}
+	return data, nil
+}
+
+func (RowCodec) Decode(data []byte) (row parquet.Row, err error) {
+	defer func() {
+		// Kind.Value panics on invalid data.
+		if r := recover(); r != nil {
+			err = errors.Errorf("invalid row: %v", r)
+		}
+	}()
+	for len(data) > 0 {
+		kind := data[0]
+		data = data[1:]
+		var fields [4]uint64
+		for i := range fields {
+			n := 0
+			fields[i], n = binary.Uvarint(data)
+			if n <= 0 || (i == 3 && uint64(len(data)-n) < fields[i]) {
+				return nil, errors.New("invalid row")
+			}
+			data = data[n:]
+		}
+		v := parquet.NullValue()
+		if kind > 0 {
+			v = parquet.Kind(kind - 1).Value(data[:fields[3]])
+		}
+		data = data[fields[3]:]
+		row = append(row, v.Level(int(fields[0]), int(fields[1]), int(fields[2])))
+	}
+	return row, nil
+}
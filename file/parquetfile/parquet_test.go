@@ -0,0 +1,95 @@
+package parquetfile_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/file/parquetfile"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type person struct {
+	Name  string   `parquet:"name"`
+	Age   int64    `parquet:"age"`
+	Score *float64 `parquet:"score,optional"`
+	Data  []byte   `parquet:"data"`
+}
+
+func score(v float64) *float64 {
+	return &v
+}
+
+func writePeople(t *testing.T, people []person) *bytes.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	// small row groups to read several of them.
+	w := parquet.NewGenericWriter[person](buf, parquet.MaxRowsPerRowGroup(3))
+	_, err := w.Write(people)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestSort(t *testing.T) {
+	input := writePeople(t, []person{
+		{Name: "carol", Age: 30, Score: score(1.5), Data: []byte{0, '\n'}},
+		{Name: "bob", Age: 25},
+		{Name: "alice", Age: 30, Score: score(2)},
+		{Name: "dave", Age: 20, Score: score(-1)},
+		{Name: "erin", Age: 25, Score: score(0)},
+		{Name: "frank", Age: 40},
+		{Name: "grace", Age: 20},
+	})
+	tcs := map[string]struct {
+		columns  []string
+		expected []string
+	}{
+		"age and name": {
+			columns:  []string{"age", "name"},
+			expected: []string{"dave", "grace", "bob", "erin", "alice", "carol", "frank"},
+		},
+		"nulls first": {
+			columns:  []string{"score", "name"},
+			expected: []string{"bob", "frank", "grace", "dave", "erin", "carol", "alice"},
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			err := parquetfile.Sort(context.Background(), input, input.Size(), output, tc.columns, file.Sorter[parquet.Row]{
+				ChunkFolder: t.TempDir(),
+				ChunkSize:   2,
+				Workers:     2,
+				BufferSize:  2,
+			})
+			require.NoError(t, err)
+			got, err := parquet.Read[person](bytes.NewReader(output.Bytes()), int64(output.Len()))
+			require.NoError(t, err)
+			names := make([]string, 0, len(got))
+			for _, p := range got {
+				names = append(names, p.Name)
+				if p.Name == "carol" {
+					assert.Equal(t, []byte{0, '\n'}, p.Data)
+					assert.Equal(t, 1.5, *p.Score)
+				}
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestSortUnknownColumn(t *testing.T) {
+	input := writePeople(t, []person{{Name: "alice"}})
+	err := parquetfile.Sort(context.Background(), input, input.Size(), &bytes.Buffer{}, []string{"height"}, file.Sorter[parquet.Row]{
+		ChunkFolder: t.TempDir(),
+		ChunkSize:   2,
+		Workers:     2,
+		BufferSize:  2,
+	})
+	assert.Error(t, err)
+}
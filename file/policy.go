@@ -0,0 +1,58 @@
+package file
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorPolicy tells how the rows whose key can't be allocated are handled
+// when creating the chunks.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyFail stops the sort on the first invalid row. It is the
+	// default policy.
+	ErrorPolicyFail ErrorPolicy = "fail"
+	// ErrorPolicySkip drops the invalid rows.
+	ErrorPolicySkip ErrorPolicy = "skip"
+	// ErrorPolicyQuarantine drops the invalid rows and writes them to the
+	// Quarantine writer with their line number and the reason.
+	ErrorPolicyQuarantine ErrorPolicy = "quarantine"
+)
+
+// ParseErrorPolicy returns the policy with the given name.
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	switch policy := ErrorPolicy(strings.ToLower(name)); policy {
+	case ErrorPolicyFail, ErrorPolicySkip, ErrorPolicyQuarantine:
+		return policy, nil
+	case "":
+		return ErrorPolicyFail, nil
+	default:
+		return "", errors.Errorf("unknown error policy %q", name)
+	}
+}
+
+// rejectRow applies the error policy to the row that can't be sorted. It
+// returns an error if the sort must stop.
+func (i *Info) rejectRow(row int, line string, err error) error {
+	switch i.ErrorPolicy {
+	case ErrorPolicySkip:
+	case ErrorPolicyQuarantine:
+		_, qErr := fmt.Fprintf(i.Quarantine, "%d\t%q\t%s\n", row, err.Error(), line)
+		if qErr != nil {
+			return errors.Wrap(qErr, "writing to quarantine")
+		}
+	default:
+		return &SortError{Phase: PhaseChunking, Line: row, Err: err}
+	}
+	i.skippedRows++
+	return nil
+}
+
+// SkippedRows returns the number of rows dropped by the error policy when
+// creating the chunks.
+func (i *Info) SkippedRows() int {
+	return i.skippedRows
+}
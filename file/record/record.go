@@ -0,0 +1,160 @@
+// Package record frames the records of the inputs, the chunks and the outputs
+// of the sort. A record is a string holding any bytes.
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// Reader reads the records one by one. *bufio.Scanner is a Reader.
+type Reader interface {
+	// Scan advances to the next record. It returns false at the end of the
+	// input or on error.
+	Scan() bool
+	// Text returns the record read by the last call to Scan.
+	Text() string
+	// Err returns the first error, other than io.EOF, met by Scan.
+	Err() error
+}
+
+// Writer writes the records one by one.
+type Writer interface {
+	// Write writes the record.
+	Write(record string) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+// Format creates the readers and writers of a framing of records.
+type Format interface {
+	NewReader(r io.Reader) Reader
+	NewWriter(w io.Writer) Writer
+}
+
+var (
+	// Lines frames the records with a new line after each of them. The
+	// records must not contain new lines.
+	Lines Format = lines{}
+	// Varint frames each record with its length as an unsigned varint, so
+	// that they can hold any bytes. A record is at most MaxRecordSize bytes.
+	Varint Format = varint{}
+)
+
+type lines struct{}
+
+func (lines) NewReader(r io.Reader) Reader {
+	return bufio.NewScanner(r)
+}
+
+func (lines) NewWriter(w io.Writer) Writer {
+	return &linesWriter{w: bufio.NewWriter(w)}
+}
+
+type linesWriter struct {
+	w *bufio.Writer
+}
+
+func (w *linesWriter) Write(record string) error {
+	_, err := w.w.WriteString(record)
+	if err != nil {
+		return err
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *linesWriter) Flush() error {
+	return w.w.Flush()
+}
+
+type varint struct{}
+
+func (varint) NewReader(r io.Reader) Reader {
+	return &varintReader{r: bufio.NewReader(r)}
+}
+
+func (varint) NewWriter(w io.Writer) Writer {
+	return &varintWriter{w: bufio.NewWriter(w)}
+}
+
+type varintReader struct {
+	r      *bufio.Reader
+	err    error
+	record []byte
+}
+
+func (r *varintReader) Scan() bool {
+	if r.err != nil {
+		return false
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if errors.Is(err, io.EOF) {
+		r.err = io.EOF
+		return false
+	}
+	if err != nil {
+		r.err = errors.Wrap(err, "reading record length")
+		return false
+	}
+	if size > MaxRecordSize {
+		r.err = errors.Errorf("record length %d is larger than %d", size, MaxRecordSize)
+		return false
+	}
+	// a corrupt length is only allocated as far as the input goes.
+	r.record = r.record[:0]
+	for remaining := int(size); remaining > 0; {
+		step := min(remaining, readStep)
+		n := len(r.record)
+		r.record = slices.Grow(r.record, step)[:n+step]
+		_, err = io.ReadFull(r.r, r.record[n:])
+		if err != nil {
+			r.err = errors.Wrap(err, "reading record")
+			return false
+		}
+		remaining -= step
+	}
+	return true
+}
+
+func (r *varintReader) Text() string {
+	return string(r.record)
+}
+
+func (r *varintReader) Err() error {
+	if errors.Is(r.err, io.EOF) {
+		return nil
+	}
+	return r.err
+}
+
+// MaxRecordSize is the maximum length of a Varint record.
+const MaxRecordSize = 1 << 30
+
+// readStep is the number of bytes of a Varint record read at once.
+const readStep = 64 * 1024
+
+type varintWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *varintWriter) Write(record string) error {
+	if len(record) > MaxRecordSize {
+		return errors.Errorf("record length %d is larger than %d", len(record), MaxRecordSize)
+	}
+	n := binary.PutUvarint(w.buf[:], uint64(len(record)))
+	_, err := w.w.Write(w.buf[:n])
+	if err != nil {
+		return err
+	}
+	_, err = w.w.WriteString(record)
+	return err
+}
+
+func (w *varintWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,51 @@
+package record_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/askiada/external-sort/file/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roundTrip(t *testing.T, format record.Format, records []string) []string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := format.NewWriter(buf)
+	for _, rec := range records {
+		require.NoError(t, w.Write(rec))
+	}
+	require.NoError(t, w.Flush())
+	got := []string{}
+	r := format.NewReader(buf)
+	for r.Scan() {
+		got = append(got, r.Text())
+	}
+	require.NoError(t, r.Err())
+	return got
+}
+
+func TestFormats(t *testing.T) {
+	lines := []string{"b", "", "a\tc"}
+	assert.Equal(t, lines, roundTrip(t, record.Lines, lines))
+
+	records := []string{"a\nb", "", "\x00\xff", string(bytes.Repeat([]byte{1}, 300)), string(bytes.Repeat([]byte{2}, 200000))}
+	assert.Equal(t, records, roundTrip(t, record.Varint, records))
+}
+
+func TestVarintTruncated(t *testing.T) {
+	r := record.Varint.NewReader(bytes.NewReader([]byte{5, 'a', 'b'}))
+	assert.False(t, r.Scan())
+	assert.Error(t, r.Err())
+}
+
+func TestVarintCorruptLength(t *testing.T) {
+	for _, size := range []uint64{record.MaxRecordSize + 1, 1 << 62, record.MaxRecordSize} {
+		data := binary.AppendUvarint(nil, size)
+		r := record.Varint.NewReader(bytes.NewReader(append(data, 'a', 'b')))
+		assert.False(t, r.Scan())
+		assert.Error(t, r.Err())
+	}
+}
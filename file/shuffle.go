@@ -0,0 +1,120 @@
+package file
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/askiada/external-sort/file/record"
+	"github.com/askiada/external-sort/vector/typed"
+	"github.com/pkg/errors"
+)
+
+// shufflePrefixLen is the length of the random key prefixed to the rows in
+// the chunks, as 16 hexadecimal digits.
+const shufflePrefixLen = 16
+
+// Shuffle shuffles the Input instead of sorting it, like shuf or sort -R. Each
+// row is given a random key when creating the chunks and the chunks are
+// merged by these keys, so that inputs larger than the memory can be
+// shuffled.
+type Shuffle struct {
+	// Seed makes the order reproducible for the same input.
+	Seed int64
+	// Group returns the group of a row. When set, the key of a row is a hash
+	// of its group and the Seed, so that the rows of a group are kept
+	// together. A row whose group can't be computed is handled by the
+	// ErrorPolicy. Otherwise, each row gets its own random key, prefixed to
+	// the row in the chunks.
+	Group func(line string) (string, error)
+}
+
+// random returns whether the rows are given a random key, stored in the chunks
+// as a prefix of the rows.
+func (s *Shuffle) random() bool {
+	return s.Group == nil
+}
+
+// allocate returns the allocator of the shuffle keys.
+func (s *Shuffle) allocate() *typed.Allocate[shuffleKey] {
+	if s.random() {
+		return typed.NewAllocate(allocatePrefixKey, compareShuffleKeys)
+	}
+	return typed.NewAllocate(func(line string) (shuffleKey, error) {
+		group, err := s.Group(line)
+		if err != nil {
+			return shuffleKey{}, err
+		}
+		return shuffleKey{value: s.hash(group), line: line}, nil
+	}, compareShuffleKeys)
+}
+
+// hash returns the seeded hash of the group.
+func (s *Shuffle) hash(group string) uint64 {
+	h := fnv.New64a()
+	seed := [8]byte{}
+	binary.LittleEndian.PutUint64(seed[:], uint64(s.Seed))
+	_, _ = h.Write(seed[:])
+	_, _ = h.Write([]byte(group))
+	// fnv alone keeps similar groups close to each other.
+	return mix(h.Sum64())
+}
+
+// newPrefixer returns a function prefixing the rows with a random key drawn
+// from the Seed. It must not be called concurrently.
+func (s *Shuffle) newPrefixer() func(line string) string {
+	// nolint:gosec // the order doesn't need a secure random source.
+	rng := rand.New(rand.NewSource(s.Seed))
+	return func(line string) string {
+		return fmt.Sprintf("%016x", rng.Uint64()) + line
+	}
+}
+
+// mix is the finalizer of splitmix64, spreading the bits of x.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// allocatePrefixKey returns the random key prefixed to the line.
+func allocatePrefixKey(line string) (shuffleKey, error) {
+	if len(line) < shufflePrefixLen {
+		return shuffleKey{}, errors.Errorf("missing shuffle key in %q", line)
+	}
+	value, err := strconv.ParseUint(line[:shufflePrefixLen], 16, 64)
+	if err != nil {
+		return shuffleKey{}, errors.Wrap(err, "invalid shuffle key")
+	}
+	return shuffleKey{value: value}, nil
+}
+
+// shuffleKey orders the rows by their random key. The rows of a group with the
+// same key are ordered by their line to keep the order reproducible.
+type shuffleKey struct {
+	value uint64
+	line  string
+}
+
+func compareShuffleKeys(a, b shuffleKey) int {
+	if c := cmp.Compare(a.value, b.value); c != 0 {
+		return c
+	}
+	return strings.Compare(a.line, b.line)
+}
+
+// unprefixWriter removes the random key prefixed to the records.
+type unprefixWriter struct {
+	record.Writer
+}
+
+func (w *unprefixWriter) Write(rec string) error {
+	return w.Writer.Write(rec[shufflePrefixLen:])
+}
@@ -2,8 +2,14 @@ package file
 
 import (
 	"bufio"
+	"context"
+	"io"
+	"strconv"
 
+	"github.com/askiada/external-sort/file/record"
 	"github.com/askiada/external-sort/vector"
+	"github.com/askiada/external-sort/vector/key"
+	"github.com/askiada/external-sort/vector/typed"
 	"github.com/cheggaaa/pb/v3"
 	"github.com/pkg/errors"
 )
@@ -12,34 +18,100 @@ func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-// MergeSort sorts the file from it's chunks.
+// MergeSort sorts the file from it's chunks. If the input fitted in a single
+// chunk that was never written to disk, it is written directly to the Output.
+// The chunks are closed and removed whether the merge succeeds or not, unless
+// KeepChunks is set.
 func (i *Info) MergeSort(k int) error {
-	output := i.Allocate.Vector(k, i.Allocate.Key)
-	chunks := &chunks{list: make([]*chunkInfo, 0, len(i.chunkPaths))}
-	for _, chunkPath := range i.chunkPaths {
-		err := chunks.new(chunkPath, i.Allocate, k)
+	return i.MergeSortContext(context.Background(), k)
+}
+
+// MergeSortContext is like MergeSort but stops the merge and returns
+// ctx.Err() once the context is cancelled.
+func (i *Info) MergeSortContext(ctx context.Context, k int) (err error) {
+	// the chunks are kept so that the merge can be called again.
+	if k <= 0 {
+		return errors.New("buffer size must be greater than 0")
+	}
+	defer func() {
+		if err != nil {
+			i.discard()
+			return
+		}
+		err = i.cleanup()
+	}()
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if i.memChunk != nil {
+		return i.writeMemChunk()
+	}
+	return i.keys().mergeSort(ctx, i, k)
+}
+
+// Merge merges the inputs into the output. Each input must already be sorted
+// according to the keys of allocate. The bufferSize is the amount of rows we
+// keep in memory per input. The inputs are neither closed nor removed. The
+// inputs and the output are framed with record.Lines.
+func Merge(ctx context.Context, inputs []io.Reader, output io.Writer, allocate *vector.Allocate, bufferSize int) error {
+	return MergeFormat(ctx, record.Lines, inputs, output, allocate, bufferSize)
+}
+
+// MergeFormat is like Merge but frames the inputs and the output with the
+// format.
+func MergeFormat(ctx context.Context, format record.Format, inputs []io.Reader, output io.Writer,
+	allocate *vector.Allocate, bufferSize int,
+) error {
+	if len(inputs) == 0 {
+		return ErrNoInput
+	}
+	if output == nil {
+		return ErrNoOutput
+	}
+	if allocate == nil {
+		return ErrNoAllocator
+	}
+	if bufferSize <= 0 {
+		return errors.New("buffer size must be greater than 0")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	chunks := &chunks[key.Key]{list: make([]*chunkInfo[key.Key], 0, len(inputs)), format: format, less: allocate.Less}
+	for idx, input := range inputs {
+		err := chunks.newFromReader("input "+strconv.Itoa(idx+1), input, allocate, bufferSize)
 		if err != nil {
 			return errors.Wrap(err, "failed to create chunk")
 		}
 	}
+	return mergeChunks(ctx, chunks, format.NewWriter(output), allocate, bufferSize, pb.New(0))
+}
 
-	outputBuffer := bufio.NewWriter(i.Output)
+// mergeChunks merges the sorted chunks into the output with a k-way merge. k
+// is the size of the buffer used for each chunk and for the output. The context
+// is checked each time the output buffer is written.
+func mergeChunks[K any](ctx context.Context, chunks *chunks[K], outputBuffer record.Writer, allocate typed.Allocator[K], k int,
+	bar *pb.ProgressBar,
+) error {
+	outputVector := vectorLines[K]{allocate.NewVector(k)}
 
-	bar := pb.StartNew(i.totalRows)
 	chunks.resetOrder()
 	for chunks.len() > 0 {
-		if output.Len() == k {
-			err := WriteBuffer(outputBuffer, output)
+		if outputVector.Len() == k {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := writeRecords(outputBuffer, outputVector)
 			if err != nil {
-				return errors.Wrap(err, "failed to write buffer")
+				return &SortError{Phase: PhaseMerging, Err: errors.Wrap(err, "failed to write buffer")}
 			}
 		}
 		toShrink := []int{}
 		// search the smallest value across chunk buffers by comparing first elements only
 		minChunk, minValue, minIdx := chunks.min()
-		err := output.PushBack(minValue.Line)
+		err := outputVector.v.PushBack(minValue.Line)
 		if err != nil {
-			return errors.Wrap(err, "failed to push back to output")
+			return minChunk.error(errors.Wrap(err, "failed to push back to output"))
 		}
 		// remove the first element from the chunk we pulled the smallest value
 		minChunk.buffer.FrontShift()
@@ -66,19 +138,36 @@ func (i *Info) MergeSort(k int) error {
 		bar.Increment()
 	}
 
-	err := WriteBuffer(outputBuffer, output)
+	err := writeRecords(outputBuffer, outputVector)
 	if err != nil {
-		return errors.Wrap(err, "failed to write buffer")
+		return &SortError{Phase: PhaseMerging, Err: errors.Wrap(err, "failed to write buffer")}
 	}
 
 	err = outputBuffer.Flush()
 	if err != nil {
-		return errors.Wrap(err, "failed to flush output buffer")
+		return &SortError{Phase: PhaseMerging, Err: errors.Wrap(err, "failed to flush output buffer")}
 	}
-	bar.Finish()
-	return chunks.close()
+	return nil
+}
+
+// writeMemChunk writes the in-memory chunk, which is already sorted, to the
+// Output.
+func (i *Info) writeMemChunk() error {
+	outputBuffer := i.outputWriter()
+	err := writeRecords(outputBuffer, i.memChunk)
+	if err != nil {
+		return &SortError{Phase: PhaseMerging, Err: errors.Wrap(err, "failed to write buffer")}
+	}
+	i.memChunk = nil
+	err = outputBuffer.Flush()
+	if err != nil {
+		return &SortError{Phase: PhaseMerging, Err: errors.Wrap(err, "failed to flush output buffer")}
+	}
+	return nil
 }
 
+// WriteBuffer writes the rows to the buffer, one per line, and resets the
+// rows.
 func WriteBuffer(buffer *bufio.Writer, rows vector.Vector) error {
 	for i := 0; i < rows.Len(); i++ {
 		_, err := buffer.WriteString(rows.Get(i).Line + "\n")
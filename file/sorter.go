@@ -0,0 +1,159 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/askiada/external-sort/file/record"
+	"github.com/askiada/external-sort/vector/typed"
+	"github.com/pkg/errors"
+)
+
+// Codec encodes values to bytes and decodes them back.
+type Codec[T any] interface {
+	Encode(value T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// Sorter sorts values of type T with the external-sort algorithm. The values
+// are encoded with the Codec in the chunks, so they don't need to be
+// stringified by the caller.
+type Sorter[T any] struct {
+	Codec Codec[T]
+	// Less returns whether a is smaller than b.
+	Less func(a, b T) bool
+	// ChunkFolder and ChunkStore are used as in Info.
+	ChunkFolder string
+	ChunkStore  ChunkStore
+	// ChunkSize is the maximum number of values per chunk.
+	ChunkSize int
+	// Workers is the number of chunks sorted at the same time.
+	Workers int
+	// BufferSize is the number of values buffered per chunk when merging.
+	BufferSize     int
+	MaxTempBytes   int64
+	CompressChunks bool
+	// Progress draws a progress bar on stderr while merging.
+	Progress bool
+}
+
+// Sort reads the values from in until it is closed, and calls yield with each
+// value in ascending order. It stops with the error returned by yield, or once
+// the context is cancelled. The values are framed with record.Varint.
+func (s *Sorter[T]) Sort(ctx context.Context, in <-chan T, yield func(T) error) error {
+	if s.Codec == nil {
+		return ErrNoCodec
+	}
+	if s.Less == nil {
+		return ErrNoLess
+	}
+	if yield == nil {
+		return ErrNoOutput
+	}
+	if s.ChunkSize <= 0 {
+		return errors.New("chunk size must be greater than 0")
+	}
+	if s.Workers <= 0 {
+		return errors.New("workers must be greater than 0")
+	}
+	if s.BufferSize <= 0 {
+		return errors.New("buffer size must be greater than 0")
+	}
+	pr, pw := io.Pipe()
+	yielded := make(chan error, 1)
+	go func() {
+		err := s.yieldAll(pr, yield)
+		// a failure stops the merge writing to the pipe.
+		pr.CloseWithError(err)
+		yielded <- err
+	}()
+	info := &Info{
+		Input:          &encodeReader[T]{ctx: ctx, in: in, codec: s.Codec},
+		Output:         pw,
+		Format:         record.Varint,
+		ChunkFolder:    s.ChunkFolder,
+		ChunkStore:     s.ChunkStore,
+		Keys:           TypedKeys(typed.NewAllocate(s.decode, s.compare)),
+		MaxTempBytes:   s.MaxTempBytes,
+		CompressChunks: s.CompressChunks,
+		NoProgress:     !s.Progress,
+	}
+	err := info.Sort(ctx, s.ChunkSize, s.Workers, s.BufferSize)
+	pw.CloseWithError(err)
+	yieldErr := <-yielded
+	if err != nil {
+		return err
+	}
+	return yieldErr
+}
+
+// yieldAll decodes the records of r and yields the values.
+func (s *Sorter[T]) yieldAll(r io.Reader, yield func(T) error) error {
+	records := record.Varint.NewReader(r)
+	for records.Scan() {
+		value, err := s.Codec.Decode([]byte(records.Text()))
+		if err != nil {
+			return errors.Wrap(err, "decoding value")
+		}
+		err = yield(value)
+		if err != nil {
+			return err
+		}
+	}
+	return records.Err()
+}
+
+// decode decodes the value of the record.
+func (s *Sorter[T]) decode(line string) (T, error) {
+	value, err := s.Codec.Decode([]byte(line))
+	return value, errors.Wrap(err, "decoding value")
+}
+
+// compare compares the values with Less.
+func (s *Sorter[T]) compare(a, b T) int {
+	switch {
+	case s.Less(a, b):
+		return -1
+	case s.Less(b, a):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// encodeReader reads the values of a channel as varint framed records.
+type encodeReader[T any] struct {
+	ctx   context.Context
+	in    <-chan T
+	codec Codec[T]
+	buf   bytes.Buffer
+}
+
+func (r *encodeReader[T]) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		var value T
+		var ok bool
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case value, ok = <-r.in:
+		}
+		if !ok {
+			return 0, io.EOF
+		}
+		data, err := r.codec.Encode(value)
+		if err != nil {
+			return 0, errors.Wrap(err, "encoding value")
+		}
+		records := record.Varint.NewWriter(&r.buf)
+		err = records.Write(string(data))
+		if err == nil {
+			err = records.Flush()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.buf.Read(p)
+}
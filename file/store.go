@@ -0,0 +1,380 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// ChunkStore stores the chunks created while sorting. Chunks are identified
+// by a name without any path separator. It must be safe for concurrent use.
+type ChunkStore interface {
+	// Create creates the chunk, or truncates it if it already exists.
+	Create(name string) (io.WriteCloser, error)
+	// Open opens the chunk for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Remove removes the chunk.
+	Remove(name string) error
+	// List returns the names of all the chunks in the store.
+	List() ([]string, error)
+}
+
+var (
+	_ ChunkStore = &DiskStore{}
+	_ ChunkStore = &MemStore{}
+	_ ChunkStore = &AferoStore{}
+)
+
+// DiskStore stores the chunks as files in a folder on the local disk.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore returns a store writing the chunks in dir. The folder is
+// created if it doesn't exist.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating chunk folder")
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Path returns the path of the chunk on disk.
+func (s *DiskStore) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// FreeSpace returns the number of bytes available on the disk holding the
+// folder.
+func (s *DiskStore) FreeSpace() (uint64, error) {
+	return freeSpace(s.dir)
+}
+
+func (s *DiskStore) Create(name string) (io.WriteCloser, error) {
+	return os.Create(s.Path(name))
+}
+
+func (s *DiskStore) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.Path(name))
+}
+
+func (s *DiskStore) Remove(name string) error {
+	return os.Remove(s.Path(name))
+}
+
+func (s *DiskStore) List() ([]string, error) {
+	dir, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(dir))
+	for _, d := range dir {
+		names = append(names, d.Name())
+	}
+	return names, nil
+}
+
+// MemStore stores the chunks in memory. It is meant for tests and for
+// environments without a writable disk.
+type MemStore struct {
+	chunks map[string][]byte
+	mu     sync.RWMutex
+}
+
+// NewMemStore returns an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{chunks: map[string][]byte{}}
+}
+
+// memChunkWriter buffers a chunk and saves it in the store when closed.
+type memChunkWriter struct {
+	bytes.Buffer
+	store *MemStore
+	name  string
+}
+
+func (w *memChunkWriter) Close() error {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.chunks[w.name] = w.Bytes()
+	return nil
+}
+
+func (s *MemStore) Create(name string) (io.WriteCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks[name] = nil
+	return &memChunkWriter{store: s, name: name}, nil
+}
+
+func (s *MemStore) Open(name string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	chunk, ok := s.chunks[name]
+	if !ok {
+		return nil, errors.Wrap(os.ErrNotExist, name)
+	}
+	return io.NopCloser(bytes.NewReader(chunk)), nil
+}
+
+func (s *MemStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chunks[name]; !ok {
+		return errors.Wrap(os.ErrNotExist, name)
+	}
+	delete(s.chunks, name)
+	return nil
+}
+
+func (s *MemStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.chunks))
+	for name := range s.chunks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// AferoStore stores the chunks in a folder of an afero file system.
+type AferoStore struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewAferoStore returns a store writing the chunks in the folder dir of fs.
+// The folder is created if it doesn't exist.
+func NewAferoStore(fs afero.Fs, dir string) (*AferoStore, error) {
+	err := fs.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating chunk folder")
+	}
+	return &AferoStore{fs: fs, dir: dir}, nil
+}
+
+func (s *AferoStore) Create(name string) (io.WriteCloser, error) {
+	return s.fs.Create(filepath.Join(s.dir, name))
+}
+
+func (s *AferoStore) Open(name string) (io.ReadCloser, error) {
+	return s.fs.Open(filepath.Join(s.dir, name))
+}
+
+func (s *AferoStore) Remove(name string) error {
+	return s.fs.Remove(filepath.Join(s.dir, name))
+}
+
+func (s *AferoStore) List() ([]string, error) {
+	dir, err := afero.ReadDir(s.fs, s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(dir))
+	for _, d := range dir {
+		names = append(names, d.Name())
+	}
+	return names, nil
+}
+
+// lockFile is the name of the lock file of a RunStore.
+const lockFile = ".lock"
+
+// chunkPath returns the path of the chunk if the store has a Path method, as
+// the stores on disk, or the name otherwise.
+func chunkPath(store ChunkStore, name string) string {
+	if s, ok := store.(interface{ Path(string) string }); ok {
+		return s.Path(name)
+	}
+	return name
+}
+
+// Cleaner is implemented by the stores created for a single run.
+type Cleaner interface {
+	// Cleanup releases the store. Its chunks are removed unless keepChunks
+	// is true.
+	Cleanup(keepChunks bool) error
+}
+
+var (
+	_ ChunkStore = &RunStore{}
+	_ Cleaner    = &RunStore{}
+)
+
+// RunStore is a DiskStore in a unique folder created for a single run, so
+// several sorts can share the same parent folder. A lock file holding the
+// process id tells other processes the folder is in use.
+type RunStore struct {
+	*DiskStore
+}
+
+// NewRunStore creates a unique folder in parent and returns a store writing
+// the chunks in it. Call Cleanup to remove it.
+func NewRunStore(parent string) (*RunStore, error) {
+	err := os.MkdirAll(parent, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating chunk folder")
+	}
+	dir, err := os.MkdirTemp(parent, "external-sort-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating run folder")
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating lock file")
+	}
+	_, err = lock.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if err != nil {
+		lock.Close()
+		return nil, errors.Wrap(err, "writing lock file")
+	}
+	err = lock.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "writing lock file")
+	}
+	return &RunStore{DiskStore: &DiskStore{dir: dir}}, nil
+}
+
+// Dir returns the folder of the run.
+func (s *RunStore) Dir() string {
+	return s.dir
+}
+
+// List returns the names of the chunks, without the lock file.
+func (s *RunStore) List() ([]string, error) {
+	names, err := s.DiskStore.List()
+	if err != nil {
+		return nil, err
+	}
+	chunks := names[:0]
+	for _, name := range names {
+		if name != lockFile {
+			chunks = append(chunks, name)
+		}
+	}
+	return chunks, nil
+}
+
+// Cleanup removes the lock file and, unless keepChunks is true, the folder of
+// the run with all its chunks.
+func (s *RunStore) Cleanup(keepChunks bool) error {
+	if keepChunks {
+		err := os.Remove(filepath.Join(s.dir, lockFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "removing lock file")
+		}
+		return nil
+	}
+	return errors.Wrap(os.RemoveAll(s.dir), "removing run folder")
+}
+
+var (
+	_ ChunkStore = &LazyStore{}
+	_ Cleaner    = &LazyStore{}
+	_ FreeSpacer = &LazyStore{}
+)
+
+// LazyStore creates its store the first time a chunk is created, so that
+// nothing is written when the input fits in memory.
+type LazyStore struct {
+	newStore func() (ChunkStore, error)
+	store    ChunkStore
+	mu       sync.Mutex
+}
+
+// NewLazyStore returns a store calling newStore the first time a chunk is
+// created.
+func NewLazyStore(newStore func() (ChunkStore, error)) *LazyStore {
+	return &LazyStore{newStore: newStore}
+}
+
+// get returns the store, creating it if required.
+func (s *LazyStore) get() (ChunkStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		store, err := s.newStore()
+		if err != nil {
+			return nil, err
+		}
+		s.store = store
+	}
+	return s.store, nil
+}
+
+// created returns the store, or nil if it has not been created.
+func (s *LazyStore) created() ChunkStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+func (s *LazyStore) Create(name string) (io.WriteCloser, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return store.Create(name)
+}
+
+func (s *LazyStore) Open(name string) (io.ReadCloser, error) {
+	store := s.created()
+	if store == nil {
+		return nil, errors.Wrap(os.ErrNotExist, name)
+	}
+	return store.Open(name)
+}
+
+func (s *LazyStore) Remove(name string) error {
+	store := s.created()
+	if store == nil {
+		return errors.Wrap(os.ErrNotExist, name)
+	}
+	return store.Remove(name)
+}
+
+func (s *LazyStore) List() ([]string, error) {
+	store := s.created()
+	if store == nil {
+		return nil, nil
+	}
+	return store.List()
+}
+
+// Cleanup releases the store if it was created and implements Cleaner.
+func (s *LazyStore) Cleanup(keepChunks bool) error {
+	cleaner, ok := s.created().(Cleaner)
+	if !ok {
+		return nil
+	}
+	return cleaner.Cleanup(keepChunks)
+}
+
+// FreeSpace returns the free space of the store, creating it if required. It
+// fails if the store doesn't implement FreeSpacer.
+func (s *LazyStore) FreeSpace() (uint64, error) {
+	store, err := s.get()
+	if err != nil {
+		return 0, err
+	}
+	spacer, ok := store.(FreeSpacer)
+	if !ok {
+		return 0, errors.New("the store doesn't implement FreeSpacer")
+	}
+	return spacer.FreeSpace()
+}
+
+// Path returns the path of the chunk if the store is on disk, or the name
+// otherwise.
+func (s *LazyStore) Path(name string) string {
+	return chunkPath(s.created(), name)
+}
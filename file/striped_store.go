@@ -0,0 +1,263 @@
+package file
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StripeStrategy tells a StripedStore on which store to create a chunk.
+type StripeStrategy string
+
+const (
+	// StripeRoundRobin creates the chunks on each store in turn.
+	StripeRoundRobin StripeStrategy = "round_robin"
+	// StripeFreeSpace creates each chunk on the store with the most free
+	// space. Every store must implement FreeSpacer.
+	StripeFreeSpace StripeStrategy = "free_space"
+)
+
+// ParseStripeStrategy returns the strategy with the given name.
+func ParseStripeStrategy(name string) (StripeStrategy, error) {
+	switch strategy := StripeStrategy(name); strategy {
+	case StripeRoundRobin, StripeFreeSpace:
+		return strategy, nil
+	case "":
+		return StripeRoundRobin, nil
+	default:
+		return "", errors.Errorf("unknown stripe strategy %q", name)
+	}
+}
+
+// FreeSpacer is implemented by the stores able to tell how many bytes can
+// still be written to them.
+type FreeSpacer interface {
+	FreeSpace() (uint64, error)
+}
+
+var (
+	_ ChunkStore = &StripedStore{}
+	_ Cleaner    = &StripedStore{}
+)
+
+// StripedStore spreads the chunks over several stores, for example one per
+// disk, to share the I/O bandwidth and the disk usage.
+type StripedStore struct {
+	// location is the index of the store holding each chunk.
+	location map[string]int
+	strategy StripeStrategy
+	stores   []ChunkStore
+	next     int
+	mu       sync.Mutex
+}
+
+// NewStripedStore returns a store spreading the chunks over the stores with
+// the strategy.
+func NewStripedStore(strategy StripeStrategy, stores ...ChunkStore) (*StripedStore, error) {
+	if len(stores) == 0 {
+		return nil, errors.New("at least one store is required")
+	}
+	if strategy == StripeFreeSpace {
+		for _, store := range stores {
+			if _, ok := store.(FreeSpacer); !ok {
+				return nil, errors.Errorf("the %s strategy requires stores implementing FreeSpacer", strategy)
+			}
+		}
+	}
+	return &StripedStore{
+		location: map[string]int{},
+		strategy: strategy,
+		stores:   stores,
+	}, nil
+}
+
+// NewStripedRunStore returns a store spreading the chunks over a RunStore in
+// each folder with the strategy. It returns a RunStore if there is only one
+// folder.
+func NewStripedRunStore(strategy StripeStrategy, dirs ...string) (ChunkStore, error) {
+	stores := make([]ChunkStore, 0, len(dirs))
+	for _, dir := range dirs {
+		store, err := NewRunStore(dir)
+		if err != nil {
+			for _, created := range stores {
+				created.(Cleaner).Cleanup(false) // nolint:errcheck,forcetypeassert // best effort.
+			}
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	if len(stores) == 1 {
+		return stores[0], nil
+	}
+	return NewStripedStore(strategy, stores...)
+}
+
+// pick returns the index of the store where the next chunk is created.
+func (s *StripedStore) pick() (int, error) {
+	if s.strategy != StripeFreeSpace {
+		idx := s.next
+		s.next = (s.next + 1) % len(s.stores)
+		return idx, nil
+	}
+	best, bestSpace := 0, uint64(0)
+	for idx, store := range s.stores {
+		space, err := store.(FreeSpacer).FreeSpace() // nolint:forcetypeassert // checked in NewStripedStore.
+		if err != nil {
+			return 0, errors.Wrap(err, "reading free space")
+		}
+		if space > bestSpace {
+			best, bestSpace = idx, space
+		}
+	}
+	return best, nil
+}
+
+// find returns the index of the store holding the chunk, or -1.
+func (s *StripedStore) find(name string) int {
+	if idx, ok := s.location[name]; ok {
+		return idx
+	}
+	for idx, store := range s.stores {
+		names, err := store.List()
+		if err != nil {
+			continue
+		}
+		for _, n := range names {
+			if n == name {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
+func (s *StripedStore) Create(name string) (io.WriteCloser, error) {
+	s.mu.Lock()
+	idx, ok := s.location[name]
+	if !ok {
+		var err error
+		idx, err = s.pick()
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.location[name] = idx
+	}
+	s.mu.Unlock()
+	return s.stores[idx].Create(name)
+}
+
+func (s *StripedStore) Open(name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	idx := s.find(name)
+	s.mu.Unlock()
+	if idx == -1 {
+		return nil, errors.Wrap(os.ErrNotExist, name)
+	}
+	return s.stores[idx].Open(name)
+}
+
+func (s *StripedStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.find(name)
+	if idx == -1 {
+		return errors.Wrap(os.ErrNotExist, name)
+	}
+	delete(s.location, name)
+	return s.stores[idx].Remove(name)
+}
+
+// List returns the names of the chunks of every store. A name is only listed
+// once even if several stores hold it.
+func (s *StripedStore) List() ([]string, error) {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, store := range s.stores {
+		storeNames, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range storeNames {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// Cleanup calls Cleanup on every store implementing Cleaner.
+func (s *StripedStore) Cleanup(keepChunks bool) error {
+	for _, store := range s.stores {
+		cleaner, ok := store.(Cleaner)
+		if !ok {
+			continue
+		}
+		err := cleaner.Cleanup(keepChunks)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FreeSpace returns the free space of all the stores. It fails if one of them
+// doesn't implement FreeSpacer.
+func (s *StripedStore) FreeSpace() (uint64, error) {
+	total := uint64(0)
+	for _, store := range s.stores {
+		spacer, ok := store.(FreeSpacer)
+		if !ok {
+			return 0, errors.New("a store doesn't implement FreeSpacer")
+		}
+		space, err := spacer.FreeSpace()
+		if err != nil {
+			return 0, err
+		}
+		total += space
+	}
+	return total, nil
+}
+
+// checkSpace checks size bytes of chunks fit in the stores. The round robin
+// puts about size/N bytes on each of the N stores, so each store is checked
+// against its share, as several stores may share a disk. The free space
+// strategy creates the chunks where there is room, so only the total free
+// space is checked.
+func (s *StripedStore) checkSpace(size uint64) error {
+	if s.strategy == StripeFreeSpace {
+		free, err := s.FreeSpace()
+		if err != nil {
+			return nil // nolint:nilerr // the check is best effort.
+		}
+		if size > free {
+			return errors.Wrapf(ErrNoSpace, "the chunks need about %d bytes, %d bytes are free", size, free)
+		}
+		return nil
+	}
+	n := uint64(len(s.stores))
+	share := (size + n - 1) / n
+	for _, store := range s.stores {
+		err := checkSpace(store, share)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path returns the path of the chunk if the store holding it is on disk, or
+// the name otherwise.
+func (s *StripedStore) Path(name string) string {
+	s.mu.Lock()
+	idx := s.find(name)
+	s.mu.Unlock()
+	if idx == -1 {
+		return name
+	}
+	return chunkPath(s.stores[idx], name)
+}
@@ -1,37 +1,308 @@
 package internal
 
-// this file contains the settings for environment variables.
+// this file contains the settings for environment variables, command line
+// flags and config files.
 
 import (
+	"strings"
+	"time"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 // Argument names.
 const (
+	ConfigName           = "config"
 	InputFileName        = "input_path"
 	OutputFileName       = "output_path"
 	ChunkFolderName      = "chunk_folder"
+	ChunkStripingName    = "chunk_striping"
 	ChunkSizeName        = "chunk_size"
 	MaxWorkersName       = "max_workers"
 	OutputBufferSizeName = "output_buffer_size"
+	CompressChunksName   = "compress_chunks"
+	MaxTempBytesName     = "max_temp_bytes"
+	KeepChunksName       = "keep_chunks"
+	ErrorPolicyName      = "on_error"
+	QuarantineFileName   = "quarantine_path"
+	FormatName           = "format"
+	KeyName              = "key"
+	ColumnName           = "column"
+	ReverseName          = "reverse"
+	ShuffleName          = "shuffle"
+	SeedName             = "seed"
+	GroupName            = "group"
 )
 
 // Environment variables.
 var (
 	InputFile        string
 	OutputFile       string
-	ChunkFolder      string
+	ChunkFolders     []string
+	ChunkStriping    file.StripeStrategy
 	ChunkSize        int
 	MaxWorkers       int64
 	OutputBufferSize int
+	CompressChunks   bool
+	MaxTempBytes     int64
+	KeepChunks       bool
+	ErrorPolicy      file.ErrorPolicy
+	QuarantineFile   string
+	Format           string
+	Keys             []KeySpec
+	Columns          []string
+	Reverse          bool
+	Shuffle          bool
+	Seed             int64
+	Group            bool
 )
 
+// job lists the settings that can be set in a config file.
+type job struct {
+	InputFile        string   `mapstructure:"input_path"`
+	OutputFile       string   `mapstructure:"output_path"`
+	ChunkFolders     []string `mapstructure:"chunk_folder"`
+	ChunkStriping    string   `mapstructure:"chunk_striping"`
+	ErrorPolicy      string   `mapstructure:"on_error"`
+	QuarantineFile   string   `mapstructure:"quarantine_path"`
+	Format           string   `mapstructure:"format"`
+	Keys             []string `mapstructure:"key"`
+	Columns          []string `mapstructure:"column"`
+	ChunkSize        int      `mapstructure:"chunk_size"`
+	MaxWorkers       int64    `mapstructure:"max_workers"`
+	OutputBufferSize int      `mapstructure:"output_buffer_size"`
+	MaxTempBytes     int64    `mapstructure:"max_temp_bytes"`
+	CompressChunks   bool     `mapstructure:"compress_chunks"`
+	KeepChunks       bool     `mapstructure:"keep_chunks"`
+	Reverse          bool     `mapstructure:"reverse"`
+	Shuffle          bool     `mapstructure:"shuffle"`
+	Seed             int64    `mapstructure:"seed"`
+	Group            bool     `mapstructure:"group"`
+}
+
+// EnvPrefix is the prefix of the environment variables, so that unrelated
+// variables such as KEY or FORMAT are ignored.
+const EnvPrefix = "EXTERNAL_SORT"
+
+// legacyEnvNames are the settings also read from their environment variable
+// without the EnvPrefix, as before it was added. The prefixed variable takes
+// precedence.
+var legacyEnvNames = []string{
+	InputFileName,
+	OutputFileName,
+	ChunkFolderName,
+	ChunkSizeName,
+	MaxWorkersName,
+	OutputBufferSizeName,
+}
+
 func init() {
+	viper.SetEnvPrefix(EnvPrefix)
 	viper.AutomaticEnv()
+	for _, name := range legacyEnvNames {
+		env := strings.ToUpper(name)
+		// nolint:errcheck // BindEnv only fails without a name.
+		viper.BindEnv(name, EnvPrefix+"_"+env, env)
+	}
+	viper.SetDefault(ConfigName, "")
 	viper.SetDefault(InputFileName, "")
 	viper.SetDefault(OutputFileName, "")
-	viper.SetDefault(ChunkFolderName, "")
+	viper.SetDefault(ChunkFolderName, []string{})
+	viper.SetDefault(ChunkStripingName, string(file.StripeRoundRobin))
 	viper.SetDefault(ChunkSizeName, 0)
 	viper.SetDefault(MaxWorkersName, 0)
 	viper.SetDefault(OutputBufferSizeName, 0)
+	viper.SetDefault(CompressChunksName, false)
+	viper.SetDefault(MaxTempBytesName, 0)
+	viper.SetDefault(KeepChunksName, false)
+	viper.SetDefault(ErrorPolicyName, string(file.ErrorPolicyFail))
+	viper.SetDefault(QuarantineFileName, "")
+	viper.SetDefault(FormatName, FormatTsv)
+	viper.SetDefault(KeyName, []string{"1"})
+	viper.SetDefault(ColumnName, []string{})
+	viper.SetDefault(ReverseName, false)
+	viper.SetDefault(ShuffleName, false)
+	viper.SetDefault(GroupName, false)
+	// the seed has no default, a random one is drawn when it isn't set.
+}
+
+// ConfigFlag adds the config file flag to the command.
+func ConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().String(ConfigName, "", "yaml or toml config file describing the job. Flags and environment variables take precedence.")
+}
+
+// InputFlag adds the input file flag to the command.
+func InputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP(InputFileName, "i", "", "input file path, stdin if empty or \"-\".")
+}
+
+// OutputFlag adds the output file flag to the command.
+func OutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP(OutputFileName, "o", "", "output file path, stdout if empty or \"-\".")
+}
+
+// ChunkSizeFlag adds the chunk size flag to the command.
+func ChunkSizeFlag(cmd *cobra.Command) {
+	cmd.Flags().IntP(ChunkSizeName, "s", 0, "chunk size.")
+}
+
+// ChunkFlags adds the flags used to create the chunks to the command.
+func ChunkFlags(cmd *cobra.Command) {
+	ChunkSizeFlag(cmd)
+	cmd.Flags().StringSliceP(ChunkFolderName, "c", nil, "folder where a unique folder is created for the chunks, can be repeated to spread the chunks over several folders.")
+	cmd.Flags().String(ChunkStripingName, string(file.StripeRoundRobin), "how the chunks are spread over the chunk folders: round_robin or free_space.")
+	cmd.Flags().Int64P(MaxWorkersName, "w", 0, "max worker.")
+	cmd.Flags().Bool(CompressChunksName, false, "compress the chunks with gzip.")
+	cmd.Flags().Int64(MaxTempBytesName, 0, "maximum number of bytes written to the chunk folders, 0 means no limit.")
+}
+
+// ErrorPolicyFlags adds the flags handling the invalid rows to the command.
+func ErrorPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().String(ErrorPolicyName, string(file.ErrorPolicyFail), "what to do with rows whose key is invalid: fail, skip or quarantine.")
+	cmd.Flags().String(QuarantineFileName, "", "file receiving the invalid rows with the quarantine policy.")
+}
+
+// KeepChunksFlag adds the flag keeping the chunks once merged to the command.
+func KeepChunksFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool(KeepChunksName, false, "keep the chunks once merged, for debugging.")
+}
+
+// OutputBufferFlag adds the output buffer size flag to the command.
+func OutputBufferFlag(cmd *cobra.Command) {
+	cmd.Flags().IntP(OutputBufferSizeName, "b", 0, "output buffer size.")
+}
+
+// KeyFlags adds the flags describing the format of the rows and the keys to
+// the command.
+func KeyFlags(cmd *cobra.Command) {
+	cmd.Flags().String(FormatName, FormatTsv, "format of the rows: tsv or line.")
+	cmd.Flags().BoolP(ReverseName, "r", false, "sort in descending order.")
+	cmd.Flags().StringArrayP(KeyName, "k", []string{"1"}, "key as FIELD[OPTIONS][@LANGUAGE][,NULLS], can be repeated. FIELD starts at 1, the options are n, f, b, d, V, N and S.")
+}
+
+// ShuffleFlags adds the flags shuffling the rows instead of sorting them to the
+// command.
+func ShuffleFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(ShuffleName, false, "shuffle the rows instead of sorting them.")
+	cmd.Flags().Int64(SeedName, 0, "seed of the shuffle, for a reproducible order. A random seed is used if not set.")
+	cmd.Flags().Bool(GroupName, false, "keep the rows with equal keys together when shuffling.")
+}
+
+// ColumnFlag adds the flag of the Parquet columns to sort by to the command.
+func ColumnFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray(ColumnName, nil, "dot separated path of a Parquet column to sort by, can be repeated.")
+}
+
+// Load binds the flags of the command to viper and loads the settings. A flag
+// set on the command line takes precedence over the environment variable,
+// which takes precedence over the config file. Only the settings used by the
+// command are validated.
+func Load(cmd *cobra.Command) error {
+	err := viper.BindPFlags(cmd.Flags())
+	if err != nil {
+		return errors.Wrap(err, "binding flags")
+	}
+	if configFile := viper.GetString(ConfigName); configFile != "" {
+		err = readConfig(configFile)
+		if err != nil {
+			return err
+		}
+	}
+	InputFile = viper.GetString(InputFileName)
+	OutputFile = viper.GetString(OutputFileName)
+	ChunkFolders = viper.GetStringSlice(ChunkFolderName)
+	ChunkStriping, err = file.ParseStripeStrategy(viper.GetString(ChunkStripingName))
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", ChunkStripingName)
+	}
+	ChunkSize = viper.GetInt(ChunkSizeName)
+	MaxWorkers = viper.GetInt64(MaxWorkersName)
+	OutputBufferSize = viper.GetInt(OutputBufferSizeName)
+	CompressChunks = viper.GetBool(CompressChunksName)
+	MaxTempBytes = viper.GetInt64(MaxTempBytesName)
+	KeepChunks = viper.GetBool(KeepChunksName)
+	QuarantineFile = viper.GetString(QuarantineFileName)
+	ErrorPolicy, err = file.ParseErrorPolicy(viper.GetString(ErrorPolicyName))
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", ErrorPolicyName)
+	}
+	Format = viper.GetString(FormatName)
+	Keys = Keys[:0]
+	for _, spec := range viper.GetStringSlice(KeyName) {
+		ks, err := ParseKeySpec(spec)
+		if err != nil {
+			return errors.Wrap(err, KeyName)
+		}
+		Keys = append(Keys, ks)
+	}
+	Columns = viper.GetStringSlice(ColumnName)
+	Reverse = viper.GetBool(ReverseName)
+	Shuffle = viper.GetBool(ShuffleName)
+	Seed = viper.GetInt64(SeedName)
+	if !viper.IsSet(SeedName) {
+		Seed = time.Now().UnixNano()
+	}
+	Group = viper.GetBool(GroupName)
+	return validate(cmd)
+}
+
+// readConfig merges the config file into the settings. It returns an error
+// naming the field if the file contains an unknown or invalid field.
+func readConfig(configFile string) error {
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		return errors.Wrap(err, "reading config")
+	}
+	err = v.UnmarshalExact(&job{})
+	if err != nil {
+		return errors.Wrapf(err, "invalid config %s", configFile)
+	}
+	return viper.MergeConfigMap(v.AllSettings())
+}
+
+// validate checks the settings used by the command.
+func validate(cmd *cobra.Command) error {
+	positive := map[string]int64{
+		ChunkSizeName:        int64(ChunkSize),
+		MaxWorkersName:       MaxWorkers,
+		OutputBufferSizeName: int64(OutputBufferSize),
+	}
+	for name, value := range positive {
+		if cmd.Flags().Lookup(name) != nil && value <= 0 {
+			return errors.Errorf("invalid %s: must be greater than 0", name)
+		}
+	}
+	if MaxTempBytes < 0 {
+		return errors.Errorf("invalid %s: must not be negative", MaxTempBytesName)
+	}
+	if cmd.Flags().Lookup(ChunkFolderName) != nil && len(ChunkFolders) == 0 {
+		return errors.Errorf("invalid %s: must not be empty", ChunkFolderName)
+	}
+	if ErrorPolicy == file.ErrorPolicyQuarantine && QuarantineFile == "" {
+		return errors.Errorf("invalid %s: required by the %s policy", QuarantineFileName, file.ErrorPolicyQuarantine)
+	}
+	if cmd.Flags().Lookup(FormatName) != nil && Format != FormatTsv && Format != FormatLine {
+		return errors.Errorf("invalid %s: unknown format %q", FormatName, Format)
+	}
+	if cmd.Flags().Lookup(ColumnName) != nil && len(Columns) == 0 {
+		return errors.Errorf("invalid %s: must not be empty", ColumnName)
+	}
+	if Group && !Shuffle {
+		return errors.Errorf("invalid %s: requires --%s", GroupName, ShuffleName)
+	}
+	if Shuffle && Reverse {
+		return errors.Errorf("invalid %s: can't be combined with --%s", ReverseName, ShuffleName)
+	}
+	if cmd.Flags().Lookup(KeyName) != nil {
+		_, err := NewAllocateKey(Format, Keys)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", KeyName)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,334 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/askiada/external-sort/vector/key"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+// Input formats.
+const (
+	// FormatTsv reads the keys from the tab separated fields of each row.
+	FormatTsv = "tsv"
+	// FormatLine reads the key from the whole row.
+	FormatLine = "line"
+)
+
+// NullPolicy tells how the missing and empty fields of a key are handled.
+type NullPolicy string
+
+// Null policies.
+const (
+	// NullsKeep fails on the missing fields and compares the empty fields as
+	// any other value. It is the default.
+	NullsKeep NullPolicy = ""
+	// NullsError fails on the missing and empty fields.
+	NullsError NullPolicy = "error"
+	// NullsFirst sorts the missing and empty fields first.
+	NullsFirst NullPolicy = "first"
+	// NullsLast sorts the missing and empty fields last.
+	NullsLast NullPolicy = "last"
+	// NullsDefault replaces the missing and empty fields with a default value.
+	NullsDefault NullPolicy = "default"
+)
+
+// KeySpec describes how a key is read from a row.
+type KeySpec struct {
+	// Field is the tsv field the key is read from, starting at 1.
+	Field int
+	// Language compares the field with the collation rules of the language.
+	// It is empty for a byte-wise comparison.
+	Language string
+	// Numeric compares the field as an integer instead of a string.
+	Numeric bool
+	// Natural compares the sequences of digits of the field numerically.
+	Natural bool
+	// SemVer compares the field as a semantic version.
+	SemVer bool
+	// IgnoreCase, IgnoreLeadingBlanks, Dictionary and Version are the
+	// collation options of key.CollateOptions.
+	IgnoreCase          bool
+	IgnoreLeadingBlanks bool
+	Dictionary          bool
+	Version             bool
+	// Reverse compares the field in descending order. The null placement of
+	// nulls=first and nulls=last is kept.
+	Reverse bool
+	// Nulls handles the missing and empty fields.
+	Nulls NullPolicy
+	// Default replaces the missing and empty fields with NullsDefault.
+	Default string
+}
+
+// collated tells whether the field is compared with a collation.
+func (ks KeySpec) collated() bool {
+	return ks.Language != "" || ks.IgnoreCase || ks.IgnoreLeadingBlanks || ks.Dictionary || ks.Version
+}
+
+// ParseKeySpec parses a key described as FIELD[OPTIONS][@LANGUAGE][,NULLS], where
+// FIELD is the tsv field starting at 1 and OPTIONS is a list of letters:
+//   - n compares the field as an integer.
+//   - f ignores the case.
+//   - b ignores the leading blanks.
+//   - d only considers blanks, letters and digits.
+//   - V compares the sequences of digits numerically, for versions.
+//   - N compares the sequences of digits numerically and the rest byte-wise.
+//   - S compares the field as a semantic version, as v1.10.0-rc.1.
+//
+// The options f, b, d and V, as well as a BCP 47 LANGUAGE, compare the field
+// with a collation. NULLS handles the missing and empty fields: nulls=error,
+// nulls=first, nulls=last or default=VALUE. For example "2n" sorts numerically
+// on the second field, "1f@fr" sorts the first field in French, ignoring the
+// case, and "3n,default=0" sorts the missing third fields as 0.
+func ParseKeySpec(spec string) (KeySpec, error) {
+	ks := KeySpec{}
+	if idx := strings.IndexByte(spec, ','); idx >= 0 {
+		nulls := spec[idx+1:]
+		switch {
+		case strings.HasPrefix(nulls, "default="):
+			ks.Nulls = NullsDefault
+			ks.Default = strings.TrimPrefix(nulls, "default=")
+		case nulls == "nulls=error" || nulls == "nulls=first" || nulls == "nulls=last":
+			ks.Nulls = NullPolicy(strings.TrimPrefix(nulls, "nulls="))
+		default:
+			return KeySpec{}, errors.Errorf("invalid key %q: unknown null handling %q", spec, nulls)
+		}
+		spec = spec[:idx]
+	}
+	if idx := strings.IndexByte(spec, '@'); idx >= 0 {
+		tag, err := language.Parse(spec[idx+1:])
+		if err != nil {
+			return KeySpec{}, errors.Errorf("invalid key %q: unknown language %q", spec, spec[idx+1:])
+		}
+		ks.Language = tag.String()
+		spec = spec[:idx]
+	}
+	digits := strings.IndexFunc(spec, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if digits == -1 {
+		digits = len(spec)
+	}
+	field, err := strconv.Atoi(spec[:digits])
+	if err != nil || field < 1 {
+		return KeySpec{}, errors.Errorf("invalid key %q: the field must be a number greater than 0", spec)
+	}
+	ks.Field = field
+	for _, option := range spec[digits:] {
+		switch option {
+		case 'n':
+			ks.Numeric = true
+		case 'f':
+			ks.IgnoreCase = true
+		case 'b':
+			ks.IgnoreLeadingBlanks = true
+		case 'd':
+			ks.Dictionary = true
+		case 'V':
+			ks.Version = true
+		case 'N':
+			ks.Natural = true
+		case 'S':
+			ks.SemVer = true
+		default:
+			return KeySpec{}, errors.Errorf("invalid key %q: unknown option %q", spec, option)
+		}
+	}
+	comparisons := 0
+	for _, set := range []bool{ks.Numeric, ks.Natural, ks.SemVer, ks.collated()} {
+		if set {
+			comparisons++
+		}
+	}
+	if comparisons > 1 {
+		return KeySpec{}, errors.Errorf("invalid key %q: n, N, S and the collation can't be combined", spec)
+	}
+	return ks, nil
+}
+
+// NewAllocateKey returns a function that allocates the key of a row. The row
+// is read with the format and the key is made of every spec, in order.
+func NewAllocateKey(format string, specs []KeySpec) (func(line string) (key.Key, error), error) {
+	if len(specs) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	allocators := make([]func(value string, present bool) (key.Key, error), len(specs))
+	for i, spec := range specs {
+		allocator, err := fieldAllocator(spec)
+		if err != nil {
+			return nil, err
+		}
+		allocators[i] = allocator
+	}
+	switch format {
+	case FormatTsv:
+		return func(line string) (key.Key, error) {
+			fields := strings.Split(line, "\t")
+			keys := make([]key.Key, len(specs))
+			for i, spec := range specs {
+				value, present := "", len(fields) >= spec.Field
+				if present {
+					value = fields[spec.Field-1]
+				}
+				k, err := allocators[i](value, present)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = k
+			}
+			if len(keys) == 1 {
+				return keys[0], nil
+			}
+			return key.NewComposite(keys...), nil
+		}, nil
+	case FormatLine:
+		if len(specs) > 1 || specs[0].Field != 1 {
+			return nil, errors.Errorf("the %s format only supports one key on field 1", FormatLine)
+		}
+		return func(line string) (key.Key, error) {
+			return allocators[0](line, true)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown format %q", format)
+	}
+}
+
+// NewGroupKey returns a function that returns the group of a row for the
+// shuffle: the fields of the keys joined by tabs, so that the rows with equal
+// keys are kept together. The rows whose key is invalid are rejected as when
+// sorting.
+func NewGroupKey(format string, specs []KeySpec) (func(line string) (string, error), error) {
+	allocateKey, err := NewAllocateKey(format, specs)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatLine {
+		return func(line string) (string, error) {
+			_, err := allocateKey(line)
+			return line, err
+		}, nil
+	}
+	return func(line string) (string, error) {
+		_, err := allocateKey(line)
+		if err != nil {
+			return "", err
+		}
+		fields := strings.Split(line, "\t")
+		group := make([]string, len(specs))
+		for i, spec := range specs {
+			if len(fields) >= spec.Field {
+				group[i] = fields[spec.Field-1]
+			}
+			if group[i] == "" && spec.Nulls == NullsDefault {
+				group[i] = spec.Default
+			}
+		}
+		return strings.Join(group, "\t"), nil
+	}, nil
+}
+
+// fieldAllocator returns the function allocating the key of a field, present
+// or not in the row, according to the null policy.
+func fieldAllocator(spec KeySpec) (func(value string, present bool) (key.Key, error), error) {
+	allocate, err := valueAllocator(spec)
+	if err != nil {
+		return nil, err
+	}
+	missing := func(present bool) error {
+		if !present {
+			return errors.Errorf("field %d is missing", spec.Field)
+		}
+		return errors.Errorf("field %d is empty", spec.Field)
+	}
+	switch spec.Nulls {
+	case NullsKeep:
+		return func(value string, present bool) (key.Key, error) {
+			if !present {
+				return nil, missing(present)
+			}
+			return allocate(value)
+		}, nil
+	case NullsError:
+		return func(value string, present bool) (key.Key, error) {
+			if !present || value == "" {
+				return nil, missing(present)
+			}
+			return allocate(value)
+		}, nil
+	case NullsFirst, NullsLast:
+		nullsLast := spec.Nulls == NullsLast
+		return func(value string, present bool) (key.Key, error) {
+			if !present || value == "" {
+				return key.NewNullable(nil, nullsLast), nil
+			}
+			k, err := allocate(value)
+			if err != nil {
+				return nil, err
+			}
+			return key.NewNullable(k, nullsLast), nil
+		}, nil
+	case NullsDefault:
+		_, err = allocate(spec.Default)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid default %q", spec.Default)
+		}
+		return func(value string, present bool) (key.Key, error) {
+			if !present || value == "" {
+				value = spec.Default
+			}
+			return allocate(value)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown null policy %q", spec.Nulls)
+	}
+}
+
+// valueAllocator returns the function allocating the key of a value, in
+// descending order when the spec is reversed.
+func valueAllocator(spec KeySpec) (func(value string) (key.Key, error), error) {
+	allocate, err := orderedAllocator(spec)
+	if err != nil || !spec.Reverse {
+		return allocate, err
+	}
+	return func(value string) (key.Key, error) {
+		k, err := allocate(value)
+		if err != nil {
+			return nil, err
+		}
+		return key.NewReversed(k), nil
+	}, nil
+}
+
+// orderedAllocator returns the function allocating the key of a value, in
+// ascending order.
+func orderedAllocator(spec KeySpec) (func(value string) (key.Key, error), error) {
+	switch {
+	case spec.Numeric:
+		return key.AllocateInt, nil
+	case spec.Natural:
+		return key.AllocateNatural, nil
+	case spec.SemVer:
+		return key.AllocateSemVer, nil
+	case spec.collated():
+		tag := language.Und
+		if spec.Language != "" {
+			var err error
+			tag, err = language.Parse(spec.Language)
+			if err != nil {
+				return nil, errors.Errorf("unknown language %q", spec.Language)
+			}
+		}
+		return key.NewCollatedAllocator(key.CollateOptions{
+			Language:            tag,
+			IgnoreCase:          spec.IgnoreCase,
+			IgnoreLeadingBlanks: spec.IgnoreLeadingBlanks,
+			Dictionary:          spec.Dictionary,
+			Version:             spec.Version,
+		}), nil
+	default:
+		return key.AllocateString, nil
+	}
+}
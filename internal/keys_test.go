@@ -0,0 +1,225 @@
+package internal_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/askiada/external-sort/internal"
+	"github.com/askiada/external-sort/vector"
+	"github.com/askiada/external-sort/vector/key"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeySpec(t *testing.T) {
+	tcs := map[string]struct {
+		spec     string
+		expected internal.KeySpec
+		wantErr  bool
+	}{
+		"field":          {spec: "2", expected: internal.KeySpec{Field: 2}},
+		"numeric":        {spec: "12n", expected: internal.KeySpec{Field: 12, Numeric: true}},
+		"no field":       {spec: "n", wantErr: true},
+		"zero field":     {spec: "0", wantErr: true},
+		"unknown option": {spec: "1x", wantErr: true},
+		"collation": {
+			spec:     "3fbdV@fr",
+			expected: internal.KeySpec{Field: 3, Language: "fr", IgnoreCase: true, IgnoreLeadingBlanks: true, Dictionary: true, Version: true},
+		},
+		"unknown language":  {spec: "1@not a language", wantErr: true},
+		"numeric collation": {spec: "1nf", wantErr: true},
+		"natural":           {spec: "1N", expected: internal.KeySpec{Field: 1, Natural: true}},
+		"semver":            {spec: "2S", expected: internal.KeySpec{Field: 2, SemVer: true}},
+		"natural semver":    {spec: "1NS", wantErr: true},
+		"nulls last":        {spec: "2n,nulls=last", expected: internal.KeySpec{Field: 2, Numeric: true, Nulls: internal.NullsLast}},
+		"default":           {spec: "1@fr,default=a,b", expected: internal.KeySpec{Field: 1, Language: "fr", Nulls: internal.NullsDefault, Default: "a,b"}},
+		"unknown nulls":     {spec: "1,nulls=middle", wantErr: true},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := internal.ParseKeySpec(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestNewAllocateKey(t *testing.T) {
+	allocateKey, err := internal.NewAllocateKey(internal.FormatTsv, []internal.KeySpec{
+		{Field: 2, Numeric: true},
+		{Field: 1},
+	})
+	require.NoError(t, err)
+	less := func(a, b string) bool {
+		t.Helper()
+		ka, err := allocateKey(a)
+		require.NoError(t, err)
+		kb, err := allocateKey(b)
+		require.NoError(t, err)
+		return ka.Less(kb)
+	}
+	assert.True(t, less("b\t9", "a\t10"))
+	assert.True(t, less("a\t10", "b\t10"))
+	assert.False(t, less("b\t10", "b\t10"))
+	_, err = allocateKey("a")
+	assert.Error(t, err)
+
+	_, err = internal.NewAllocateKey(internal.FormatLine, []internal.KeySpec{{Field: 2}})
+	assert.Error(t, err)
+	allocateKey, err = internal.NewAllocateKey(internal.FormatLine, []internal.KeySpec{{Field: 1, Numeric: true}})
+	require.NoError(t, err)
+	k, err := allocateKey("42")
+	require.NoError(t, err)
+	assert.IsType(t, &key.Int{}, k)
+}
+
+func TestComparisonKeys(t *testing.T) {
+	tcs := map[string]struct {
+		spec   string
+		sorted []string
+		// equal are compared equal to each other.
+		equal []string
+	}{
+		"bytes":       {spec: "1", sorted: []string{"Zoe", "apple", "Émile"}},
+		"language":    {spec: "1@fr", sorted: []string{"apple", "Émile", "Zoe"}},
+		"ignore case": {spec: "1f", sorted: []string{"apple", "Banana", "cherry"}, equal: []string{"a", "A"}},
+		"case":        {spec: "1@en", sorted: []string{"a", "A", "b"}},
+		"blanks":      {spec: "1b", sorted: []string{"  a", "b", " c"}},
+		"dictionary":  {spec: "1d", sorted: []string{"a-b", "ac", "a.d"}},
+		"version":     {spec: "1V", sorted: []string{"file2", "file10", "file10a"}},
+		"natural":     {spec: "1N", sorted: []string{"", "a", "a1b", "a01c", "a2", "a10", "a10.2", "a10.10", "b"}},
+		"semver": {spec: "1S", sorted: []string{
+			"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+			"1.0.0-beta.11", "1.0.0-rc.1", "v1.0.0", "v1.9.2", "v1.10.0", "2.0.0+build.1",
+		}},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			spec, err := internal.ParseKeySpec(tc.spec)
+			require.NoError(t, err)
+			allocateKey, err := internal.NewAllocateKey(internal.FormatLine, []internal.KeySpec{spec})
+			require.NoError(t, err)
+			for i := 1; i < len(tc.sorted); i++ {
+				prev, err := allocateKey(tc.sorted[i-1])
+				require.NoError(t, err)
+				cur, err := allocateKey(tc.sorted[i])
+				require.NoError(t, err)
+				assert.True(t, prev.Less(cur), "%q < %q", tc.sorted[i-1], tc.sorted[i])
+				assert.False(t, cur.Less(prev), "%q > %q", tc.sorted[i], tc.sorted[i-1])
+			}
+			for i := 1; i < len(tc.equal); i++ {
+				prev, err := allocateKey(tc.equal[i-1])
+				require.NoError(t, err)
+				cur, err := allocateKey(tc.equal[i])
+				require.NoError(t, err)
+				assert.False(t, prev.Less(cur), "%q == %q", tc.equal[i-1], tc.equal[i])
+				assert.False(t, cur.Less(prev), "%q == %q", tc.equal[i], tc.equal[i-1])
+			}
+		})
+	}
+}
+
+func TestSemVerInvalid(t *testing.T) {
+	for _, version := range []string{"1.0", "1.0.x", "1.0.0-", "1.0.0-a..b", ""} {
+		_, err := key.AllocateSemVer(version)
+		assert.Error(t, err, version)
+	}
+}
+
+func TestNullPolicy(t *testing.T) {
+	rows := []string{"a\t2", "b", "c\t", "d\t1"}
+	tcs := map[string]struct {
+		spec     string
+		reverse  bool
+		expected []string
+		wantErr  bool
+	}{
+		"keep":    {spec: "2n", wantErr: true},
+		"error":   {spec: "2,nulls=error", wantErr: true},
+		"first":   {spec: "2n,nulls=first", expected: []string{"b", "c\t", "d\t1", "a\t2"}},
+		"last":    {spec: "2n,nulls=last", expected: []string{"d\t1", "a\t2", "b", "c\t"}},
+		"default": {spec: "2n,default=3", expected: []string{"d\t1", "a\t2", "b", "c\t"}},
+		"first reverse": {
+			spec: "2n,nulls=first", reverse: true,
+			expected: []string{"c\t", "b", "a\t2", "d\t1"},
+		},
+		"last reverse": {
+			spec: "2n,nulls=last", reverse: true,
+			expected: []string{"a\t2", "d\t1", "c\t", "b"},
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			spec, err := internal.ParseKeySpec(tc.spec)
+			require.NoError(t, err)
+			spec.Reverse = tc.reverse
+			// the first field breaks the ties between nulls.
+			allocateKey, err := internal.NewAllocateKey(internal.FormatTsv, []internal.KeySpec{spec, {Field: 1, Reverse: tc.reverse}})
+			require.NoError(t, err)
+			v := vector.DefaultVector(allocateKey).Vector(len(rows), allocateKey)
+			for _, row := range rows {
+				err = v.PushBack(row)
+				if err != nil {
+					break
+				}
+			}
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			v.Sort()
+			got := []string{}
+			for i := 0; i < v.Len(); i++ {
+				got = append(got, v.Get(i).Line)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	_, err := internal.NewAllocateKey(internal.FormatTsv, []internal.KeySpec{{Field: 1, Numeric: true, Nulls: internal.NullsDefault, Default: "x"}})
+	assert.Error(t, err)
+}
+
+func TestNewGroupKey(t *testing.T) {
+	group, err := internal.NewGroupKey(internal.FormatTsv, []internal.KeySpec{
+		{Field: 2, Numeric: true},
+		{Field: 3, Nulls: internal.NullsDefault, Default: "x"},
+	})
+	require.NoError(t, err)
+	g, err := group("a\t1\tb")
+	require.NoError(t, err)
+	assert.Equal(t, "1\tb", g)
+	g, err = group("a\t1")
+	require.NoError(t, err)
+	assert.Equal(t, "1\tx", g)
+	_, err = group("a\tb")
+	assert.Error(t, err)
+}
+
+func TestCollatedConcurrent(t *testing.T) {
+	allocateKey := key.NewCollatedAllocator(key.CollateOptions{IgnoreCase: true})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a, err := allocateKey("apple")
+				require.NoError(t, err)
+				b, err := allocateKey("Banana")
+				require.NoError(t, err)
+				assert.True(t, a.Less(b))
+				assert.False(t, b.Less(a))
+			}
+		}()
+	}
+	wg.Wait()
+}
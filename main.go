@@ -1,76 +1,105 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/askiada/external-sort/file"
 	"github.com/askiada/external-sort/internal"
 	"github.com/askiada/external-sort/vector"
-	"github.com/askiada/external-sort/vector/key"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var log = logrus.StandardLogger()
 
 func main() {
-	rootCmd := &cobra.Command{
-		Use:   "external-sort",
-		Short: "Perform an external sorting on an input file",
-		RunE:  rootRun,
-	}
-
-	rootCmd.PersistentFlags().StringVarP(&internal.InputFile, internal.InputFileName, "i", viper.GetString(internal.InputFileName), "input file path.")
-	rootCmd.PersistentFlags().StringVarP(&internal.OutputFile, internal.OutputFileName, "o", viper.GetString(internal.OutputFileName), "output file path.")
-	rootCmd.PersistentFlags().StringVarP(&internal.ChunkFolder, internal.ChunkFolderName, "c", viper.GetString(internal.ChunkFolderName), "chunk folder.")
-
-	rootCmd.PersistentFlags().IntVarP(&internal.ChunkSize, internal.ChunkSizeName, "s", viper.GetInt(internal.ChunkSizeName), "chunk size.")
-	rootCmd.PersistentFlags().Int64VarP(&internal.MaxWorkers, internal.MaxWorkersName, "w", viper.GetInt64(internal.MaxWorkersName), "max worker.")
-	rootCmd.PersistentFlags().IntVarP(&internal.OutputBufferSize, internal.OutputBufferSizeName, "b", viper.GetInt(internal.OutputBufferSizeName), "output buffer size.")
-
-	fmt.Println("Input file", internal.InputFile)
-	fmt.Println("Output file", internal.OutputFile)
-	fmt.Println("Chunk foler", internal.ChunkFolder)
-	cobra.CheckErr(rootCmd.Execute())
+	rootCmd := newSortCmd()
+	rootCmd.Use = "external-sort"
+	rootCmd.Short = "Perform an external sorting on an input file"
+	rootCmd.SilenceUsage = true
+	rootCmd.SilenceErrors = true
+	rootCmd.AddCommand(
+		newSortCmd(),
+		newMergeCmd(),
+		newCheckCmd(),
+		newChunkCmd(),
+		newStatsCmd(),
+		newParquetCmd(),
+	)
+	// the commands stop and clean their chunks on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// a second signal kills the process while the chunks are cleaned.
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	cobra.CheckErr(err)
 }
 
-func rootRun(cmd *cobra.Command, _ []string) error {
-	start := time.Now()
-	inputPath := internal.InputFile
-	f, err := os.Open(inputPath)
+// loadSettings loads the settings of the command and logs them.
+func loadSettings(cmd *cobra.Command, _ []string) error {
+	err := internal.Load(cmd)
 	if err != nil {
-		return errors.Wrap(err, "opening input path")
+		return err
 	}
-	defer f.Close()
-	output, err := os.Create(internal.OutputFile)
+	log.WithFields(logrus.Fields{
+		"input":        internal.InputFile,
+		"output":       internal.OutputFile,
+		"chunk_folder": internal.ChunkFolders,
+	}).Info("settings")
+	return nil
+}
+
+func newAllocate() (*vector.Allocate, error) {
+	specs := make([]internal.KeySpec, len(internal.Keys))
+	for i, spec := range internal.Keys {
+		// each key is reversed, so that the nulls stay first or last.
+		spec.Reverse = internal.Reverse
+		specs[i] = spec
+	}
+	allocateKey, err := internal.NewAllocateKey(internal.Format, specs)
 	if err != nil {
-		return errors.Wrap(err, "creating output file")
+		return nil, err
 	}
-	defer func() {
-		err := output.Close()
-		if err != nil {
-			log.Error(err)
-		}
-	}()
-	fI := &file.Info{
-		Input: f,
-		Allocate: vector.DefaultVector(func(line string) (key.Key, error) {
-			return key.AllocateTsv(line, 0)
-		}),
-		Output:      output,
-		ChunkFolder: internal.ChunkFolder,
+	return vector.DefaultVector(allocateKey), nil
+}
+
+// newChunkStore returns the store spreading the chunks over a unique folder
+// created in each chunk folder the first time a chunk is created.
+func newChunkStore() (file.ChunkStore, error) {
+	return file.NewLazyStore(func() (file.ChunkStore, error) {
+		return file.NewStripedRunStore(internal.ChunkStriping, internal.ChunkFolders...)
+	}), nil
+}
+
+// openInput opens the file at the path, or returns stdin if the path is empty
+// or "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return io.NopCloser(os.Stdin), nil
 	}
+	return os.Open(path)
+}
 
-	err = fI.Sort(cmd.Context(), internal.ChunkSize, int(internal.MaxWorkers), internal.OutputBufferSize)
-	if err != nil {
-		return errors.Wrap(err, "creating chunks")
+// createOutput creates the file at the path, or returns stdout if the path is
+// empty or "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
 	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
 
-	elapsed := time.Since(start)
-	fmt.Println(elapsed)
+func (nopWriteCloser) Close() error {
 	return nil
 }
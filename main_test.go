@@ -2,20 +2,29 @@ package main_test
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/file/record"
 	"github.com/askiada/external-sort/vector"
 	"github.com/askiada/external-sort/vector/key"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
 func prepareChunks(ctx context.Context, t *testing.T, allocate *vector.Allocate, filename string, chunkSize int) *file.Info {
@@ -175,3 +184,789 @@ func TestTsvKey(t *testing.T) {
 		})
 	}
 }
+
+func TestInMemoryChunk(t *testing.T) {
+	// the input has exactly 100 rows.
+	for _, chunkSize := range []int{100, 1000} {
+		chunkSize := chunkSize
+		t.Run("chunk size "+strconv.Itoa(chunkSize), func(t *testing.T) {
+			allocate := vector.DefaultVector(key.AllocateInt)
+			ctx := context.Background()
+			fI := prepareChunks(ctx, t, allocate, "testdata/100elems.tsv", chunkSize)
+			chunks, err := filepath.Glob(filepath.Join(fI.ChunkFolder, "*", "chunk_*"))
+			require.NoError(t, err)
+			assert.Empty(t, chunks)
+
+			err = fI.MergeSort(10)
+			require.NoError(t, err)
+			outputFile := fI.Output.(*os.File)
+			outputFile.Seek(0, io.SeekStart)
+			outputScanner := bufio.NewScanner(outputFile)
+			count := 0
+			prev := -1
+			for outputScanner.Scan() {
+				num, err := strconv.Atoi(outputScanner.Text())
+				require.NoError(t, err)
+				assert.LessOrEqual(t, prev, num)
+				prev = num
+				count++
+			}
+			assert.NoError(t, outputScanner.Err())
+			assert.Equal(t, 100, count)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tcs := map[string]struct {
+		inputs         []string
+		expectedOutput []string
+	}{
+		"one input": {
+			inputs:         []string{"1\n2\n3\n"},
+			expectedOutput: []string{"1", "2", "3"},
+		},
+		"empty inputs": {
+			inputs: []string{"", ""},
+		},
+		"several inputs": {
+			inputs:         []string{"1\n4\n9\n", "", "2\n3\n10\n11\n", "0\n4\n"},
+			expectedOutput: []string{"0", "1", "2", "3", "4", "4", "9", "10", "11"},
+		},
+	}
+	allocate := vector.DefaultVector(key.AllocateInt)
+	for name, tc := range tcs {
+		tc := tc
+		for bufferSize := 1; bufferSize < 5; bufferSize++ {
+			bufferSize := bufferSize
+			t.Run(name+"_"+strconv.Itoa(bufferSize), func(t *testing.T) {
+				inputs := make([]io.Reader, 0, len(tc.inputs))
+				for _, input := range tc.inputs {
+					inputs = append(inputs, strings.NewReader(input))
+				}
+				output := &strings.Builder{}
+				err := file.Merge(context.Background(), inputs, output, allocate, bufferSize)
+				require.NoError(t, err)
+				expected := ""
+				for _, line := range tc.expectedOutput {
+					expected += line + "\n"
+				}
+				assert.Equal(t, expected, output.String())
+			})
+		}
+	}
+}
+
+func TestCheckSorted(t *testing.T) {
+	tcs := map[string]struct {
+		input        string
+		expectedLine int
+	}{
+		"empty": {
+			input: "",
+		},
+		"sorted": {
+			input: "1\n2\n2\n10\n",
+		},
+		"not sorted": {
+			input:        "1\n2\n10\n3\n1\n",
+			expectedLine: 4,
+		},
+	}
+	allocate := vector.DefaultVector(key.AllocateInt)
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			err := file.CheckSorted(strings.NewReader(tc.input), allocate)
+			if tc.expectedLine == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, file.ErrNotSorted))
+			unsortedErr := &file.UnsortedError{}
+			require.True(t, errors.As(err, &unsortedErr))
+			assert.Equal(t, tc.expectedLine, unsortedErr.Line)
+			assert.Equal(t, "10", unsortedErr.Previous.Line)
+			assert.Equal(t, "3", unsortedErr.Current.Line)
+			assert.EqualError(t, err, `line 4 is out of order: key "3" sorts before key "10" of the previous line`)
+		})
+	}
+
+	// the keys are reported instead of the rows.
+	allocateKey := func(line string) (key.Key, error) {
+		fields := strings.Split(line, "\t")
+		number, err := key.AllocateInt(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		var value key.Key
+		if fields[2] != "" {
+			value, _ = key.AllocateString(fields[2])
+		}
+		return key.NewComposite(number, key.NewNullable(value, true)), nil
+	}
+	err := file.CheckSorted(strings.NewReader("a\t2\tx\nb\t2\t\nc\t1\ty\n"), vector.DefaultVector(allocateKey))
+	assert.EqualError(t, err, `line 3 is out of order: key "(1, y)" sorts before key "(2, null)" of the previous line`)
+}
+
+func TestCompressChunks(t *testing.T) {
+	f, err := os.Open("testdata/100elems.tsv")
+	require.NoError(t, err)
+	defer f.Close()
+	chunkFolder := t.TempDir()
+	output := &strings.Builder{}
+	fI := &file.Info{
+		Input:          f,
+		Allocate:       vector.DefaultVector(key.AllocateInt),
+		Output:         output,
+		ChunkFolder:    chunkFolder,
+		CompressChunks: true,
+	}
+	err = fI.CreateSortedChunks(context.Background(), 21, 10)
+	require.NoError(t, err)
+	chunks, err := filepath.Glob(filepath.Join(chunkFolder, "*", "chunk_*"))
+	require.NoError(t, err)
+	require.Len(t, chunks, 5)
+	for _, chunk := range chunks {
+		assert.True(t, strings.HasSuffix(chunk, ".gz"))
+	}
+	err = fI.MergeSort(10)
+	require.NoError(t, err)
+	err = file.CheckSorted(strings.NewReader(output.String()), fI.Allocate)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, strings.Count(output.String(), "\n"))
+}
+
+func TestErrorPolicy(t *testing.T) {
+	input := "3\n1\nx\n2\n\n"
+	tcs := map[string]struct {
+		policy             file.ErrorPolicy
+		expectedErr        bool
+		expectedQuarantine string
+	}{
+		"fail": {
+			policy:      file.ErrorPolicyFail,
+			expectedErr: true,
+		},
+		"skip": {
+			policy: file.ErrorPolicySkip,
+		},
+		"quarantine": {
+			policy:             file.ErrorPolicyQuarantine,
+			expectedQuarantine: "3\t\"strconv.Atoi: parsing \\\"x\\\": invalid syntax\"\tx\n5\t\"strconv.Atoi: parsing \\\"\\\": invalid syntax\"\t\n",
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			output := &strings.Builder{}
+			quarantine := &strings.Builder{}
+			fI := &file.Info{
+				Input:       strings.NewReader(input),
+				Allocate:    vector.DefaultVector(key.AllocateInt),
+				Output:      output,
+				ChunkFolder: t.TempDir(),
+				ErrorPolicy: tc.policy,
+				Quarantine:  quarantine,
+			}
+			err := fI.Sort(context.Background(), 2, 1, 2)
+			if tc.expectedErr {
+				assert.True(t, errors.Is(err, &file.SortError{Phase: file.PhaseChunking}))
+				sortErr := &file.SortError{}
+				require.True(t, errors.As(err, &sortErr))
+				assert.Equal(t, 3, sortErr.Line)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "1\n2\n3\n", output.String())
+			assert.Equal(t, 2, fI.SkippedRows())
+			assert.Equal(t, tc.expectedQuarantine, quarantine.String())
+		})
+	}
+}
+
+func TestSortError(t *testing.T) {
+	inputs := []io.Reader{strings.NewReader("1\n3\n"), strings.NewReader("2\n4\nx\n")}
+	err := file.Merge(context.Background(), inputs, &strings.Builder{}, vector.DefaultVector(key.AllocateInt), 1)
+	assert.True(t, errors.Is(err, &file.SortError{}))
+	assert.True(t, errors.Is(err, &file.SortError{Phase: file.PhaseMerging}))
+	assert.False(t, errors.Is(err, &file.SortError{Phase: file.PhaseChunking}))
+	sortErr := &file.SortError{}
+	require.True(t, errors.As(err, &sortErr))
+	assert.Equal(t, "input 2", sortErr.Chunk)
+	assert.Equal(t, 3, sortErr.Line)
+	assert.EqualError(t, sortErr, `merging: chunk input 2: line 3: strconv.Atoi: parsing "x": invalid syntax`)
+
+	// the chunks of a store on disk are described by their path.
+	dir := t.TempDir()
+	store, err := file.NewDiskStore(dir)
+	require.NoError(t, err)
+	fI := &file.Info{
+		Input:        io.MultiReader(strings.NewReader(strings.Repeat("1\n", 10))),
+		Allocate:     vector.DefaultVector(key.AllocateInt),
+		Output:       &strings.Builder{},
+		ChunkStore:   store,
+		MaxTempBytes: 2,
+	}
+	err = fI.CreateSortedChunks(context.Background(), 2, 1)
+	require.True(t, errors.As(err, &sortErr))
+	assert.Equal(t, file.PhaseDumping, sortErr.Phase)
+	assert.Equal(t, dir, filepath.Dir(sortErr.Chunk))
+}
+
+func TestChunkStore(t *testing.T) {
+	aferoStore, err := file.NewAferoStore(afero.NewMemMapFs(), "chunks")
+	require.NoError(t, err)
+	diskStore, err := file.NewDiskStore(t.TempDir())
+	require.NoError(t, err)
+	diskStore2, err := file.NewDiskStore(t.TempDir())
+	require.NoError(t, err)
+	stripedStore, err := file.NewStripedStore(file.StripeFreeSpace, diskStore, diskStore2)
+	require.NoError(t, err)
+	tcs := map[string]file.ChunkStore{
+		"memory":  file.NewMemStore(),
+		"afero":   aferoStore,
+		"disk":    diskStore,
+		"striped": stripedStore,
+	}
+	for name, store := range tcs {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("testdata/100elems.tsv")
+			require.NoError(t, err)
+			defer f.Close()
+			output := &strings.Builder{}
+			fI := &file.Info{
+				Input:      f,
+				Allocate:   vector.DefaultVector(key.AllocateInt),
+				Output:     output,
+				ChunkStore: store,
+			}
+			err = fI.CreateSortedChunks(context.Background(), 21, 10)
+			require.NoError(t, err)
+			chunks, err := store.List()
+			require.NoError(t, err)
+			assert.Len(t, chunks, 5)
+
+			err = fI.MergeSort(10)
+			require.NoError(t, err)
+			err = file.CheckSorted(strings.NewReader(output.String()), fI.Allocate)
+			assert.NoError(t, err)
+			assert.Equal(t, 100, strings.Count(output.String(), "\n"))
+			chunks, err = store.List()
+			require.NoError(t, err)
+			assert.Empty(t, chunks)
+		})
+	}
+}
+
+func TestStripedStore(t *testing.T) {
+	stores := []*file.MemStore{file.NewMemStore(), file.NewMemStore(), file.NewMemStore()}
+	store, err := file.NewStripedStore(file.StripeRoundRobin, stores[0], stores[1], stores[2])
+	require.NoError(t, err)
+	f, err := os.Open("testdata/100elems.tsv")
+	require.NoError(t, err)
+	defer f.Close()
+	fI := &file.Info{
+		Input:      f,
+		Allocate:   vector.DefaultVector(key.AllocateInt),
+		Output:     &strings.Builder{},
+		ChunkStore: store,
+	}
+	err = fI.CreateSortedChunks(context.Background(), 10, 10)
+	require.NoError(t, err)
+	for _, s := range stores {
+		chunks, err := s.List()
+		require.NoError(t, err)
+		assert.NotEmpty(t, chunks)
+	}
+	chunks, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, chunks, 10)
+
+	_, err = file.NewStripedStore(file.StripeFreeSpace, stores[0])
+	assert.Error(t, err)
+}
+
+func TestMaxTempBytes(t *testing.T) {
+	input := strings.Repeat("1\n", 100)
+	tcs := map[string]struct {
+		input        io.Reader
+		maxTempBytes int64
+		chunkSize    int
+		expectedErr  error
+	}{
+		"fits in memory": {
+			input:        strings.NewReader(input),
+			maxTempBytes: 50,
+			chunkSize:    1000,
+		},
+		"under the limit": {
+			input:        strings.NewReader(input),
+			maxTempBytes: 200,
+		},
+		"known size over the limit": {
+			input:        strings.NewReader(input),
+			maxTempBytes: 199,
+			expectedErr:  file.ErrTempLimit,
+		},
+		"unknown size over the limit": {
+			input:        io.MultiReader(strings.NewReader(input)),
+			maxTempBytes: 100,
+			expectedErr:  file.ErrTempLimit,
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			fI := &file.Info{
+				Input:        tc.input,
+				Allocate:     vector.DefaultVector(key.AllocateInt),
+				Output:       &strings.Builder{},
+				ChunkStore:   file.NewMemStore(),
+				MaxTempBytes: tc.maxTempBytes,
+			}
+			chunkSize := tc.chunkSize
+			if chunkSize == 0 {
+				chunkSize = 10
+			}
+			err := fI.Sort(context.Background(), chunkSize, 2, 10)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tc.expectedErr))
+		})
+	}
+}
+
+// spaceStore is a MemStore with a fixed free space.
+type spaceStore struct {
+	*file.MemStore
+	free uint64
+}
+
+func (s *spaceStore) FreeSpace() (uint64, error) {
+	return s.free, nil
+}
+
+func TestStripedFreeSpace(t *testing.T) {
+	// the input is 200 bytes, the round robin puts about 100 bytes on each
+	// store.
+	input := strings.Repeat("1\n", 100)
+	tcs := map[string]struct {
+		strategy    file.StripeStrategy
+		free        []uint64
+		expectedErr error
+	}{
+		"round robin":            {strategy: file.StripeRoundRobin, free: []uint64{100, 100}},
+		"round robin over share": {strategy: file.StripeRoundRobin, free: []uint64{99, 1000}, expectedErr: file.ErrNoSpace},
+		"free space":             {strategy: file.StripeFreeSpace, free: []uint64{99, 1000}},
+		"free space over total":  {strategy: file.StripeFreeSpace, free: []uint64{99, 100}, expectedErr: file.ErrNoSpace},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			stores := make([]file.ChunkStore, len(tc.free))
+			for idx, free := range tc.free {
+				stores[idx] = &spaceStore{MemStore: file.NewMemStore(), free: free}
+			}
+			store, err := file.NewStripedStore(tc.strategy, stores...)
+			require.NoError(t, err)
+			fI := &file.Info{
+				Input:      strings.NewReader(input),
+				Allocate:   vector.DefaultVector(key.AllocateInt),
+				Output:     &strings.Builder{},
+				ChunkStore: store,
+			}
+			err = fI.Sort(context.Background(), 10, 2, 10)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tc.expectedErr))
+		})
+	}
+}
+
+func TestRunFolder(t *testing.T) {
+	for _, keepChunks := range []bool{false, true} {
+		keepChunks := keepChunks
+		t.Run("keep chunks "+strconv.FormatBool(keepChunks), func(t *testing.T) {
+			chunkFolder := t.TempDir()
+			other := filepath.Join(chunkFolder, "chunk_other.tsv")
+			err := os.WriteFile(other, []byte("not a chunk\n"), 0o600)
+			require.NoError(t, err)
+
+			newInfo := func() *file.Info {
+				return &file.Info{
+					Input:       strings.NewReader(strings.Repeat("2\n1\n", 50)),
+					Allocate:    vector.DefaultVector(key.AllocateInt),
+					Output:      &strings.Builder{},
+					ChunkFolder: chunkFolder,
+					KeepChunks:  keepChunks,
+				}
+			}
+			// two runs sharing the chunk folder at the same time.
+			fI1, fI2 := newInfo(), newInfo()
+			require.NoError(t, fI1.CreateSortedChunks(context.Background(), 10, 2))
+			require.NoError(t, fI2.CreateSortedChunks(context.Background(), 10, 2))
+			locks, err := filepath.Glob(filepath.Join(chunkFolder, "*", ".lock"))
+			require.NoError(t, err)
+			assert.Len(t, locks, 2)
+			require.NoError(t, fI1.MergeSort(10))
+			require.NoError(t, fI2.MergeSort(10))
+			assert.Equal(t, fI1.Output.(*strings.Builder).String(), fI2.Output.(*strings.Builder).String())
+
+			_, err = os.Stat(other)
+			assert.NoError(t, err)
+			locks, err = filepath.Glob(filepath.Join(chunkFolder, "*", ".lock"))
+			require.NoError(t, err)
+			assert.Empty(t, locks)
+			chunks, err := filepath.Glob(filepath.Join(chunkFolder, "*", "chunk_*"))
+			require.NoError(t, err)
+			if keepChunks {
+				assert.Len(t, chunks, 20)
+			} else {
+				assert.Empty(t, chunks)
+			}
+		})
+	}
+}
+
+func TestRunFolderInMemory(t *testing.T) {
+	chunkFolder := filepath.Join(t.TempDir(), "chunks")
+	fI := &file.Info{
+		Input:       strings.NewReader("2\n1\n"),
+		Allocate:    vector.DefaultVector(key.AllocateInt),
+		Output:      &strings.Builder{},
+		ChunkFolder: chunkFolder,
+	}
+	require.NoError(t, fI.CreateSortedChunks(context.Background(), 10, 2))
+	require.NoError(t, fI.MergeSort(10))
+	assert.Equal(t, "1\n2\n", fI.Output.(*strings.Builder).String())
+	// the input fits in memory, the chunk folder is never created.
+	_, err := os.Stat(chunkFolder)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestCleanupOnError(t *testing.T) {
+	input := strings.Repeat("2\n1\n", 50)
+	tcs := map[string]struct {
+		input  string
+		output io.Writer
+		cancel bool
+	}{
+		"chunking": {
+			input:  input + "x\n",
+			output: &strings.Builder{},
+		},
+		"merging": {
+			input:  input,
+			output: failingWriter{},
+		},
+		"cancelled": {
+			input:  input,
+			output: &strings.Builder{},
+			cancel: true,
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+			chunkFolder := t.TempDir()
+			fI := &file.Info{
+				Input:       strings.NewReader(tc.input),
+				Allocate:    vector.DefaultVector(key.AllocateInt),
+				Output:      tc.output,
+				ChunkFolder: chunkFolder,
+			}
+			err := fI.Sort(ctx, 10, 2, 10)
+			require.Error(t, err)
+			files, err := os.ReadDir(chunkFolder)
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+// cancelWriter cancels the context on the first write.
+type cancelWriter struct {
+	strings.Builder
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Builder.Write(p)
+}
+
+func TestInvalidBufferSize(t *testing.T) {
+	output := &strings.Builder{}
+	fI := &file.Info{
+		Input:       strings.NewReader("3\n1\n2\n5\n4\n"),
+		Allocate:    vector.DefaultVector(key.AllocateInt),
+		Output:      output,
+		ChunkFolder: t.TempDir(),
+	}
+	assert.Error(t, fI.Sort(context.Background(), 2, 2, 0))
+
+	err := fI.CreateSortedChunks(context.Background(), 2, 2)
+	require.NoError(t, err)
+	assert.Error(t, fI.MergeSortContext(context.Background(), 0))
+	// the chunks are kept for a valid merge.
+	require.NoError(t, fI.MergeSortContext(context.Background(), 2))
+	assert.Equal(t, "1\n2\n3\n4\n5\n", output.String())
+}
+
+func TestCancelQuietInput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = pw.Write([]byte("2\n1\n3\n"))
+		// the input stays open without any new row.
+		cancel()
+	}()
+	fI := &file.Info{
+		Input:       pr,
+		Allocate:    vector.DefaultVector(key.AllocateInt),
+		Output:      &strings.Builder{},
+		ChunkFolder: t.TempDir(),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fI.Sort(ctx, 2, 2, 2)
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sort is blocked by the input")
+	}
+}
+
+func TestMergeSortContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunkFolder := t.TempDir()
+	output := &cancelWriter{cancel: cancel}
+	fI := &file.Info{
+		Input:       strings.NewReader(strings.Repeat("2\n1\n", 10000)),
+		Allocate:    vector.DefaultVector(key.AllocateInt),
+		Output:      output,
+		ChunkFolder: chunkFolder,
+	}
+	err := fI.CreateSortedChunks(ctx, 1000, 2)
+	require.NoError(t, err)
+	err = fI.MergeSortContext(ctx, 10)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, strings.Count(output.String(), "\n"), 20000)
+	files, err := os.ReadDir(chunkFolder)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+type person struct {
+	Name string
+	Age  int
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(r person) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (jsonCodec) Decode(data []byte) (person, error) {
+	r := person{}
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func TestSorter(t *testing.T) {
+	sorter := &file.Sorter[person]{
+		Codec: jsonCodec{},
+		Less: func(a, b person) bool {
+			return a.Age < b.Age
+		},
+		ChunkFolder: t.TempDir(),
+		ChunkSize:   10,
+		Workers:     2,
+		BufferSize:  5,
+	}
+	in := make(chan person)
+	go func() {
+		defer close(in)
+		for i := 0; i < 100; i++ {
+			// names with new lines must survive the chunks.
+			in <- person{Name: "name\n" + strconv.Itoa(i), Age: (i * 37) % 100}
+		}
+	}()
+	got := []person{}
+	err := sorter.Sort(context.Background(), in, func(r person) error {
+		got = append(got, r)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 100)
+	for i, r := range got {
+		assert.Equal(t, i, r.Age)
+		assert.Equal(t, "name\n"+strconv.Itoa(i*73%100), r.Name)
+	}
+
+	in = make(chan person, 2)
+	in <- person{Age: 2}
+	in <- person{Age: 1}
+	close(in)
+	errYield := errors.New("yield failed")
+	err = sorter.Sort(context.Background(), in, func(person) error {
+		return errYield
+	})
+	assert.ErrorIs(t, err, errYield)
+
+	for _, invalid := range []file.Sorter[person]{
+		{ChunkSize: 0, Workers: 2, BufferSize: 5},
+		{ChunkSize: 10, Workers: 0, BufferSize: 5},
+		{ChunkSize: 10, Workers: 2, BufferSize: 0},
+	} {
+		invalid := invalid
+		invalid.Codec, invalid.Less, invalid.ChunkFolder = sorter.Codec, sorter.Less, sorter.ChunkFolder
+		err = invalid.Sort(context.Background(), make(chan person), func(person) error { return nil })
+		assert.Error(t, err)
+	}
+}
+
+func TestVarintFormat(t *testing.T) {
+	input := &bytes.Buffer{}
+	records := record.Varint.NewWriter(input)
+	for _, n := range []uint32{300, 7, 70000, 1} {
+		rec := make([]byte, 4, 6)
+		binary.BigEndian.PutUint32(rec, n)
+		// binary payloads may contain new lines.
+		require.NoError(t, records.Write(string(append(rec, '\n', 0))))
+	}
+	require.NoError(t, records.Flush())
+
+	allocate := vector.DefaultVector(func(rec string) (key.Key, error) {
+		if len(rec) < 4 {
+			return nil, errors.New("record too short")
+		}
+		return key.AllocateString(rec[:4])
+	})
+	output := &bytes.Buffer{}
+	fI := &file.Info{
+		Input:       bytes.NewReader(input.Bytes()),
+		Output:      output,
+		Format:      record.Varint,
+		Allocate:    allocate,
+		ChunkFolder: t.TempDir(),
+	}
+	err := fI.Sort(context.Background(), 2, 2, 2)
+	require.NoError(t, err)
+	sorted := output.Bytes()
+	assert.NoError(t, file.CheckSortedFormat(bytes.NewReader(sorted), record.Varint, allocate))
+	assert.ErrorIs(t, file.CheckSortedFormat(bytes.NewReader(input.Bytes()), record.Varint, allocate), file.ErrNotSorted)
+
+	merged := &bytes.Buffer{}
+	err = file.MergeFormat(context.Background(), record.Varint, []io.Reader{bytes.NewReader(sorted), bytes.NewReader(sorted)},
+		merged, allocate, 1)
+	require.NoError(t, err)
+
+	got := []uint32{}
+	r := record.Varint.NewReader(merged)
+	for r.Scan() {
+		got = append(got, binary.BigEndian.Uint32([]byte(r.Text())))
+	}
+	require.NoError(t, r.Err())
+	assert.Equal(t, []uint32{1, 1, 7, 7, 300, 300, 70000, 70000}, got)
+}
+
+func TestReverse(t *testing.T) {
+	for _, chunkSize := range []int{3, 1000} {
+		chunkSize := chunkSize
+		t.Run("chunk size "+strconv.Itoa(chunkSize), func(t *testing.T) {
+			allocate := vector.DefaultVector(key.AllocateInt)
+			allocate.Reverse = true
+			output := &strings.Builder{}
+			fI := &file.Info{
+				Input:       strings.NewReader("3\n10\n1\n7\n2\n2\n9\n"),
+				Output:      output,
+				Allocate:    allocate,
+				ChunkFolder: t.TempDir(),
+			}
+			err := fI.Sort(context.Background(), chunkSize, 2, 2)
+			require.NoError(t, err)
+			assert.Equal(t, "10\n9\n7\n3\n2\n2\n1\n", output.String())
+			assert.NoError(t, file.CheckSorted(strings.NewReader(output.String()), allocate))
+			assert.ErrorIs(t, file.CheckSorted(strings.NewReader("1\n2\n"), allocate), file.ErrNotSorted)
+		})
+	}
+
+	allocate := vector.DefaultVector(key.AllocateInt)
+	allocate.Reverse = true
+	output := &strings.Builder{}
+	err := file.Merge(context.Background(), []io.Reader{strings.NewReader("9\n4\n"), strings.NewReader("8\n5\n1\n")}, output, allocate, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "9\n8\n5\n4\n1\n", output.String())
+}
+
+func shuffle(t *testing.T, input string, chunkSize int, shuffle *file.Shuffle) []string {
+	t.Helper()
+	output := &strings.Builder{}
+	fI := &file.Info{
+		Input:       strings.NewReader(input),
+		Output:      output,
+		Shuffle:     shuffle,
+		ChunkFolder: t.TempDir(),
+	}
+	err := fI.Sort(context.Background(), chunkSize, 2, 2)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+}
+
+func TestShuffle(t *testing.T) {
+	rows := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		rows = append(rows, strconv.Itoa(i%10)+"\t"+strconv.Itoa(i))
+	}
+	input := strings.Join(rows, "\n") + "\n"
+	for _, chunkSize := range []int{7, 1000} {
+		chunkSize := chunkSize
+		t.Run("chunk size "+strconv.Itoa(chunkSize), func(t *testing.T) {
+			shuffled := shuffle(t, input, chunkSize, &file.Shuffle{Seed: 1})
+			assert.ElementsMatch(t, rows, shuffled)
+			assert.NotEqual(t, rows, shuffled)
+			assert.Equal(t, shuffled, shuffle(t, input, chunkSize, &file.Shuffle{Seed: 1}))
+			assert.NotEqual(t, shuffled, shuffle(t, input, chunkSize, &file.Shuffle{Seed: 2}))
+
+			group := func(line string) (string, error) {
+				return strings.Split(line, "\t")[0], nil
+			}
+			grouped := shuffle(t, input, chunkSize, &file.Shuffle{Seed: 1, Group: group})
+			assert.ElementsMatch(t, rows, grouped)
+			seen := map[string]bool{}
+			for i, row := range grouped {
+				g, _ := group(row)
+				if i > 0 && strings.HasPrefix(grouped[i-1], g+"\t") {
+					continue
+				}
+				assert.False(t, seen[g], "group %s is split", g)
+				seen[g] = true
+			}
+		})
+	}
+}
@@ -1,11 +1,12 @@
 package vector
 
-import "github.com/askiada/external-sort/vector/key"
+import (
+	"github.com/askiada/external-sort/vector/key"
+	"github.com/askiada/external-sort/vector/typed"
+)
 
-type Element struct {
-	Key  key.Key
-	Line string
-}
+// Element is a line with its key.Key.
+type Element = typed.Element[key.Key]
 
 // Less returns wether v1 is smaller than v2 based on the keys.
 func Less(v1, v2 *Element) bool {
@@ -0,0 +1,99 @@
+package key
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// CollateOptions tells how strings are compared by a collated key.
+type CollateOptions struct {
+	// Language selects the collation rules. The zero value uses the root
+	// collation, suitable for most languages.
+	Language language.Tag
+	// IgnoreCase folds lower case to upper case characters, as sort -f.
+	IgnoreCase bool
+	// IgnoreLeadingBlanks ignores the leading blanks, as sort -b.
+	IgnoreLeadingBlanks bool
+	// Dictionary only considers blanks, letters and digits, as sort -d.
+	Dictionary bool
+	// Version compares the sequences of digits numerically, as sort -V.
+	Version bool
+}
+
+// Collated is a string key compared with the rules of a language. It holds the
+// collation key of the string, so that comparing keys is a byte comparison.
+type Collated struct {
+	value []byte
+	// text is the string the key was made from.
+	text string
+}
+
+// NewCollatedAllocator returns a function allocating collated keys with the
+// options. It is safe for concurrent use.
+func NewCollatedAllocator(opts CollateOptions) func(value string) (Key, error) {
+	collateOpts := []collate.Option{}
+	if opts.IgnoreCase {
+		collateOpts = append(collateOpts, collate.IgnoreCase)
+	}
+	if opts.Version {
+		collateOpts = append(collateOpts, collate.Numeric)
+	}
+	// a collator is not safe for concurrent use, each goroutine takes its
+	// own from the pool.
+	pool := &sync.Pool{
+		New: func() interface{} {
+			return &collator{
+				collator: collate.New(opts.Language, collateOpts...),
+				buf:      &collate.Buffer{},
+			}
+		},
+	}
+	return func(value string) (Key, error) {
+		if opts.IgnoreLeadingBlanks {
+			value = strings.TrimLeftFunc(value, isBlank)
+		}
+		if opts.Dictionary {
+			value = strings.Map(dictionary, value)
+		}
+		// nolint:forcetypeassert // the pool only holds collators.
+		c := pool.Get().(*collator)
+		defer pool.Put(c)
+		// the collation key is only valid until the buffer is reset.
+		k := append([]byte(nil), c.collator.KeyFromString(c.buf, value)...)
+		c.buf.Reset()
+		return &Collated{value: k, text: value}, nil
+	}
+}
+
+// collator is a collator with its buffer.
+type collator struct {
+	collator *collate.Collator
+	buf      *collate.Buffer
+}
+
+func (k *Collated) Less(other Key) bool {
+	return bytes.Compare(k.value, other.(*Collated).value) < 0
+}
+
+// String returns the string the key was made from, once the leading blanks
+// or the non dictionary characters are removed.
+func (k *Collated) String() string {
+	return k.text
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// dictionary drops the runes that are neither blanks, letters nor digits.
+func dictionary(r rune) rune {
+	if isBlank(r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return r
+	}
+	return -1
+}
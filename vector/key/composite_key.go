@@ -0,0 +1,37 @@
+package key
+
+import "strings"
+
+// Composite is a key made of several keys. They are compared in order, the
+// next key is only used when the previous ones are equal.
+type Composite struct {
+	keys []Key
+}
+
+// NewComposite returns a key comparing the keys in order. Every key compared
+// with it must be a Composite with the same types of keys.
+func NewComposite(keys ...Key) *Composite {
+	return &Composite{keys}
+}
+
+func (k *Composite) Less(other Key) bool {
+	otherKeys := other.(*Composite).keys
+	for i, key := range k.keys {
+		if key.Less(otherKeys[i]) {
+			return true
+		}
+		if otherKeys[i].Less(key) {
+			return false
+		}
+	}
+	return false
+}
+
+// String returns the values of the keys, in order.
+func (k *Composite) String() string {
+	values := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		values[i] = format(key)
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
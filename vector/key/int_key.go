@@ -17,3 +17,7 @@ func AllocateInt(line string) (Key, error) {
 func (k *Int) Less(other Key) bool {
 	return k.value < other.(*Int).value
 }
+
+func (k *Int) String() string {
+	return strconv.Itoa(k.value)
+}
@@ -1,6 +1,18 @@
 package key
 
+import "fmt"
+
+// Key orders the rows. The keys may implement fmt.Stringer to describe their
+// value in errors.
 type Key interface {
 	// Less returns wether the key is smaller than v2
 	Less(v2 Key) bool
 }
+
+// format returns the value of the key.
+func format(k Key) string {
+	if s, ok := k.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(k)
+}
@@ -0,0 +1,73 @@
+package key
+
+import "strings"
+
+// Natural is a string key where the sequences of digits are compared
+// numerically, so that "file2" sorts before "file10".
+type Natural struct {
+	// parts alternate sequences of digits and of other bytes.
+	parts []string
+	value string
+}
+
+func AllocateNatural(line string) (Key, error) {
+	return &Natural{parts: splitDigits(line), value: line}, nil
+}
+
+func (k *Natural) Less(other Key) bool {
+	o := other.(*Natural)
+	for i := 0; i < len(k.parts) && i < len(o.parts); i++ {
+		if c := compareParts(k.parts[i], o.parts[i]); c != 0 {
+			return c < 0
+		}
+	}
+	if len(k.parts) != len(o.parts) {
+		return len(k.parts) < len(o.parts)
+	}
+	// "01" and "1" are equal numbers, the bytes break the tie.
+	return k.value < o.value
+}
+
+func (k *Natural) String() string {
+	return k.value
+}
+
+// splitDigits splits the string into sequences of digits and of other bytes.
+func splitDigits(s string) []string {
+	parts := []string{}
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || isDigit(s[i]) != isDigit(s[start]) {
+			parts = append(parts, s[start:i])
+			start = i
+		}
+	}
+	return parts
+}
+
+// compareParts compares two sequences of digits numerically, and any other
+// sequences byte-wise.
+func compareParts(a, b string) int {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		return compareDigits(a, b)
+	}
+	return strings.Compare(a, b)
+}
+
+// compareDigits compares the numbers written with the digits, whatever their
+// size.
+func compareDigits(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
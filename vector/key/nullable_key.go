@@ -0,0 +1,36 @@
+package key
+
+// Nullable is a key that may be null. The null keys are equal to each other and
+// sort before, or after, all the other keys.
+type Nullable struct {
+	// key is nil for a null key.
+	key       Key
+	nullsLast bool
+}
+
+// NewNullable returns the key, or a null key if it is nil. Every key compared
+// with it must be a Nullable with the same nullsLast.
+func NewNullable(k Key, nullsLast bool) *Nullable {
+	return &Nullable{key: k, nullsLast: nullsLast}
+}
+
+func (k *Nullable) Less(other Key) bool {
+	o := other.(*Nullable)
+	switch {
+	case k.key == nil && o.key == nil:
+		return false
+	case k.key == nil:
+		return !k.nullsLast
+	case o.key == nil:
+		return k.nullsLast
+	default:
+		return k.key.Less(o.key)
+	}
+}
+
+func (k *Nullable) String() string {
+	if k.key == nil {
+		return "null"
+	}
+	return format(k.key)
+}
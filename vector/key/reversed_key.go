@@ -0,0 +1,20 @@
+package key
+
+// Reversed is a key sorting in the descending order of the key it wraps.
+type Reversed struct {
+	key Key
+}
+
+// NewReversed returns the key in descending order. Every key compared with it
+// must be a Reversed of the same type of key.
+func NewReversed(k Key) *Reversed {
+	return &Reversed{key: k}
+}
+
+func (k *Reversed) Less(other Key) bool {
+	return other.(*Reversed).key.Less(k.key)
+}
+
+func (k *Reversed) String() string {
+	return format(k.key)
+}
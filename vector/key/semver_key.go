@@ -0,0 +1,102 @@
+package key
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SemVer is a semantic version key, with an optional "v" prefix, compared with
+// the semver 2.0.0 precedence: the pre-releases sort before the release and
+// the build metadata is ignored.
+type SemVer struct {
+	// core holds the major, minor and patch numbers.
+	core       [3]string
+	preRelease []string
+}
+
+func AllocateSemVer(line string) (Key, error) {
+	version := strings.TrimPrefix(line, "v")
+	if idx := strings.IndexByte(version, '+'); idx >= 0 {
+		version = version[:idx]
+	}
+	k := &SemVer{}
+	if idx := strings.IndexByte(version, '-'); idx >= 0 {
+		k.preRelease = strings.Split(version[idx+1:], ".")
+		version = version[:idx]
+		for _, id := range k.preRelease {
+			if id == "" {
+				return nil, errors.Errorf("invalid semver %q: empty pre-release identifier", line)
+			}
+		}
+	}
+	core := strings.Split(version, ".")
+	if len(core) != 3 {
+		return nil, errors.Errorf("invalid semver %q: expected MAJOR.MINOR.PATCH", line)
+	}
+	for i, number := range core {
+		if !isNumber(number) {
+			return nil, errors.Errorf("invalid semver %q: %q is not a number", line, number)
+		}
+		k.core[i] = number
+	}
+	return k, nil
+}
+
+func (k *SemVer) Less(other Key) bool {
+	o := other.(*SemVer)
+	for i := range k.core {
+		if c := compareDigits(k.core[i], o.core[i]); c != 0 {
+			return c < 0
+		}
+	}
+	switch {
+	case len(k.preRelease) == 0:
+		return false
+	case len(o.preRelease) == 0:
+		return true
+	}
+	for i := 0; i < len(k.preRelease) && i < len(o.preRelease); i++ {
+		if c := comparePreRelease(k.preRelease[i], o.preRelease[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(k.preRelease) < len(o.preRelease)
+}
+
+// String returns the version without its prefix nor its build metadata.
+func (k *SemVer) String() string {
+	version := strings.Join(k.core[:], ".")
+	if len(k.preRelease) > 0 {
+		version += "-" + strings.Join(k.preRelease, ".")
+	}
+	return version
+}
+
+// comparePreRelease compares numeric identifiers numerically, before the
+// alphanumeric ones compared byte-wise.
+func comparePreRelease(a, b string) int {
+	aNum, bNum := isNumber(a), isNumber(b)
+	switch {
+	case aNum && bNum:
+		return compareDigits(a, b)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -11,3 +11,7 @@ func AllocateString(line string) (Key, error) {
 func (k *String) Less(other Key) bool {
 	return k.value < other.(*String).value
 }
+
+func (k *String) String() string {
+	return k.value
+}
@@ -0,0 +1,74 @@
+// Package typed is the type-safe counterpart of the vector package. The keys
+// are values of type K compared with a function, instead of key.Key interfaces
+// asserting each other's type, and they are stored by value in the vectors.
+package typed
+
+// CompareFunc returns a negative number when a is smaller than b, a positive
+// number when a is greater than b and 0 otherwise.
+type CompareFunc[K any] func(a, b K) int
+
+// Element is a line with its key.
+type Element[K any] struct {
+	Key  K
+	Line string
+}
+
+// Vector holds the lines with their keys.
+type Vector[K any] interface {
+	// Get Access i-th element
+	Get(i int) *Element[K]
+	// PushBack Add item at the end
+	PushBack(line string) error
+	// FrontShift Remove the first element
+	FrontShift()
+	// Len Length of the Vector
+	Len() int
+	// Reset Clear the content in the vector
+	Reset()
+	// Sort sort the vector in ascending order
+	Sort()
+}
+
+// Allocator creates the vectors of the lines and orders their elements. The
+// file package sorts with any Allocator; *vector.Allocate is the Allocator of
+// the key.Key interfaces.
+type Allocator[K any] interface {
+	// NewVector returns an empty vector with room for size elements.
+	NewVector(size int) Vector[K]
+	// Less returns whether e1 sorts before e2.
+	Less(e1, e2 *Element[K]) bool
+	// Sort sorts the vector in the order of Less.
+	Sort(v Vector[K])
+}
+
+// Allocate allocates the keys of the lines and compares them.
+type Allocate[K any] struct {
+	Key     func(line string) (K, error)
+	Compare CompareFunc[K]
+}
+
+var _ Allocator[int] = &Allocate[int]{}
+
+// NewAllocate returns the Allocate of the keys returned by allocateKey and
+// compared with compare.
+func NewAllocate[K any](allocateKey func(line string) (K, error), compare CompareFunc[K]) *Allocate[K] {
+	return &Allocate[K]{
+		Key:     allocateKey,
+		Compare: compare,
+	}
+}
+
+// NewVector returns an empty SliceVector with room for size elements.
+func (a *Allocate[K]) NewVector(size int) Vector[K] {
+	return NewSliceVector(size, a)
+}
+
+// Less returns whether e1 is smaller than e2 based on the keys.
+func (a *Allocate[K]) Less(e1, e2 *Element[K]) bool {
+	return a.Compare(e1.Key, e2.Key) < 0
+}
+
+// Sort sorts the vector in ascending order.
+func (a *Allocate[K]) Sort(v Vector[K]) {
+	v.Sort()
+}
@@ -0,0 +1,87 @@
+package typed_test
+
+import (
+	"cmp"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/askiada/external-sort/file"
+	"github.com/askiada/external-sort/vector/typed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lines[K any](v typed.Vector[K]) []string {
+	res := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		res = append(res, v.Get(i).Line)
+	}
+	return res
+}
+
+func TestVector(t *testing.T) {
+	allocate := typed.IntAllocate()
+	v := allocate.NewVector(4)
+	for _, line := range []string{"3", "10", "1", "2"} {
+		require.NoError(t, v.PushBack(line))
+	}
+	assert.Error(t, v.PushBack("x"))
+	allocate.Sort(v)
+	assert.Equal(t, []string{"1", "2", "3", "10"}, lines(v))
+	assert.Equal(t, 1, v.Get(0).Key)
+	assert.True(t, allocate.Less(v.Get(0), v.Get(1)))
+	v.FrontShift()
+	assert.Equal(t, []string{"2", "3", "10"}, lines(v))
+	v.Reset()
+	assert.Equal(t, 0, v.Len())
+
+	reversed := typed.NewAllocate(typed.Int, typed.Reverse(cmp.Compare[int])).NewVector(2)
+	require.NoError(t, reversed.PushBack("1"))
+	require.NoError(t, reversed.PushBack("2"))
+	reversed.Sort()
+	assert.Equal(t, []string{"2", "1"}, lines(reversed))
+
+	floats := typed.NewAllocate(func(line string) (float64, error) {
+		return strconv.ParseFloat(line, 64)
+	}, cmp.Compare[float64]).NewVector(3)
+	for _, line := range []string{"2", "NaN", "1"} {
+		require.NoError(t, floats.PushBack(line))
+	}
+	floats.Sort()
+	assert.Equal(t, []string{"NaN", "1", "2"}, lines(floats))
+}
+
+func TestTypedKeys(t *testing.T) {
+	tcs := map[string]struct {
+		allocate *typed.Allocate[int]
+		expected string
+	}{
+		"ascending": {
+			allocate: typed.IntAllocate(),
+			expected: "1\n2\n3\n10\n",
+		},
+		"descending": {
+			allocate: typed.NewAllocate(typed.Int, typed.Reverse(cmp.Compare[int])),
+			expected: "10\n3\n2\n1\n",
+		},
+	}
+	for name, tc := range tcs {
+		tc := tc
+		for _, chunkSize := range []int{2, 10} {
+			t.Run(name+" chunk size "+strconv.Itoa(chunkSize), func(t *testing.T) {
+				output := &strings.Builder{}
+				fI := &file.Info{
+					Input:       strings.NewReader("3\n10\n1\n2\n"),
+					Output:      output,
+					Keys:        file.TypedKeys[int](tc.allocate),
+					ChunkFolder: t.TempDir(),
+				}
+				err := fI.Sort(context.Background(), chunkSize, 2, 2)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, output.String())
+			})
+		}
+	}
+}
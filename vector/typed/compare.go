@@ -0,0 +1,34 @@
+package typed
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+// Reverse returns the comparison in descending order of compare.
+func Reverse[K any](compare CompareFunc[K]) CompareFunc[K] {
+	return func(a, b K) int {
+		return compare(b, a)
+	}
+}
+
+// Int returns the line as an int key.
+func Int(line string) (int, error) {
+	return strconv.Atoi(line)
+}
+
+// String returns the line as a string key.
+func String(line string) (string, error) {
+	return line, nil
+}
+
+// IntAllocate returns the Allocate of the lines as int keys.
+func IntAllocate() *Allocate[int] {
+	return NewAllocate(Int, cmp.Compare[int])
+}
+
+// StringAllocate returns the Allocate of the lines as string keys.
+func StringAllocate() *Allocate[string] {
+	return NewAllocate(String, strings.Compare)
+}
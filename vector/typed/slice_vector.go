@@ -0,0 +1,61 @@
+package typed
+
+import "slices"
+
+// SliceVector is a slice of elements. The elements are stored by value, there
+// is no allocation per line besides the key itself.
+type SliceVector[K any] struct {
+	allocate *Allocate[K]
+	s        []Element[K]
+}
+
+var _ Vector[int] = &SliceVector[int]{}
+
+// NewSliceVector returns an empty vector of the keys of allocate with room for
+// size elements.
+func NewSliceVector[K any](size int, allocate *Allocate[K]) *SliceVector[K] {
+	return &SliceVector[K]{
+		allocate: allocate,
+		s:        make([]Element[K], 0, size),
+	}
+}
+
+// Get Access i-th element.
+func (v *SliceVector[K]) Get(i int) *Element[K] {
+	return &v.s[i]
+}
+
+// PushBack Add item at the end.
+func (v *SliceVector[K]) PushBack(line string) error {
+	k, err := v.allocate.Key(line)
+	if err != nil {
+		return err
+	}
+	v.s = append(v.s, Element[K]{Key: k, Line: line})
+	return nil
+}
+
+// FrontShift Remove the first element.
+func (v *SliceVector[K]) FrontShift() {
+	var zero Element[K]
+	v.s[0] = zero
+	v.s = v.s[1:]
+}
+
+// Len Length of the Vector.
+func (v *SliceVector[K]) Len() int {
+	return len(v.s)
+}
+
+// Reset Clear the content in the vector.
+func (v *SliceVector[K]) Reset() {
+	clear(v.s)
+	v.s = v.s[:0]
+}
+
+// Sort sort the vector in ascending order.
+func (v *SliceVector[K]) Sort() {
+	slices.SortFunc(v.s, func(a, b Element[K]) int {
+		return v.allocate.Compare(a.Key, b.Key)
+	})
+}
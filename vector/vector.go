@@ -3,14 +3,64 @@ package vector
 import (
 	"bufio"
 	"os"
+	"sort"
 
 	"github.com/askiada/external-sort/vector/key"
+	"github.com/askiada/external-sort/vector/typed"
 	"github.com/pkg/errors"
 )
 
+var _ typed.Allocator[key.Key] = &Allocate{}
+
 type Allocate struct {
 	Vector func(int, func(line string) (key.Key, error)) Vector
 	Key    func(line string) (key.Key, error)
+	// Reverse sorts in descending order.
+	Reverse bool
+}
+
+// Less returns whether v1 sorts before v2, in descending order when Reverse is
+// set.
+func (a *Allocate) Less(v1, v2 *Element) bool {
+	if a.Reverse {
+		return Less(v2, v1)
+	}
+	return Less(v1, v2)
+}
+
+// Sort sorts the vector in the order of Less. In descending order, the
+// elements returned by Get are swapped in place, so Get must return the
+// elements held by the vector.
+func (a *Allocate) Sort(v Vector) {
+	if a.Reverse {
+		sort.Sort(&elements{v: v, less: a.Less})
+		return
+	}
+	v.Sort()
+}
+
+// elements sorts a vector with any order through Get.
+type elements struct {
+	v    Vector
+	less func(v1, v2 *Element) bool
+}
+
+func (e *elements) Len() int {
+	return e.v.Len()
+}
+
+func (e *elements) Less(i, j int) bool {
+	return e.less(e.v.Get(i), e.v.Get(j))
+}
+
+func (e *elements) Swap(i, j int) {
+	e1, e2 := e.v.Get(i), e.v.Get(j)
+	*e1, *e2 = *e2, *e1
+}
+
+// NewVector returns an empty vector with room for size elements.
+func (a *Allocate) NewVector(size int) Vector {
+	return a.Vector(size, a.Key)
 }
 
 func DefaultVector(allocateKey func(line string) (key.Key, error)) *Allocate {
@@ -20,34 +70,25 @@ func DefaultVector(allocateKey func(line string) (key.Key, error)) *Allocate {
 	}
 }
 
-type Vector interface {
-	// Get Access i-th element
-	Get(i int) *Element
-	// PushBack Add item at the end
-	PushBack(line string) error
-	// FrontShift Remove the first element
-	FrontShift()
-	// Len Length of the Vector
-	Len() int
-	// Reset Clear the content in the vector
-	Reset()
-	// Sort sort the vector in ascending order
-	Sort()
-}
+// Vector holds the lines with their key.Key.
+type Vector = typed.Vector[key.Key]
 
 func Dump(v Vector, filename string) error {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		return errors.Errorf("failed creating file: %s", err)
+		return errors.Wrap(err, "failed creating file")
 	}
+	defer file.Close()
 	datawriter := bufio.NewWriter(file)
 	for i := 0; i < v.Len(); i++ {
 		_, err = datawriter.WriteString(v.Get(i).Line + "\n")
 		if err != nil {
-			return errors.Errorf("failed writing file: %s", err)
+			return errors.Wrap(err, "failed writing file")
 		}
 	}
-	datawriter.Flush()
-	file.Close()
-	return nil
+	err = datawriter.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed writing file")
+	}
+	return errors.Wrap(file.Close(), "failed closing file")
 }